@@ -0,0 +1,19 @@
+package postgres
+
+import "fmt"
+
+// AckError reports a standby status update that could not be sent to
+// the server; LSN is the flushed position it carried.
+type AckError struct {
+	Slot string
+	LSN  LSN
+	Err  error
+}
+
+func (e *AckError) Error() string {
+	return fmt.Sprintf("SendStandbyStatusUpdate failed on (%s#%s): %v", e.Slot, e.LSN, e.Err)
+}
+
+func (e *AckError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+)
+
+type AckMode int
+
+const (
+	// AutoAck confirms every message as soon as the MessageHandler returns.
+	AutoAck AckMode = iota
+	// ManualAck confirms messages only when the handler calls
+	// Message.Delegate.OnAck; unacknowledged messages are redelivered
+	// after a restart.
+	ManualAck
+)
+
+func (m AckMode) String() string {
+	switch m {
+	case AutoAck:
+		return "auto"
+	case ManualAck:
+		return "manual"
+	}
+	return fmt.Sprintf("AckMode(%d)", int(m))
+}
+
+func ParseAckMode(s string) (AckMode, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return AutoAck, nil
+	case "manual":
+		return ManualAck, nil
+	}
+	return 0, fmt.Errorf("unsupported ack mode '%s'", s)
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestParseAckMode(t *testing.T) {
+	for _, mode := range []AckMode{AutoAck, ManualAck} {
+		parsed, err := ParseAckMode(mode.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != mode {
+			t.Errorf("expected %s, got %s", mode, parsed)
+		}
+	}
+
+	if mode, err := ParseAckMode(""); err != nil || mode != AutoAck {
+		t.Errorf("expected the default %s, got %s (%v)", AutoAck, mode, err)
+	}
+	if mode, err := ParseAckMode("MANUAL"); err != nil || mode != ManualAck {
+		t.Errorf("expected %s, got %s (%v)", ManualAck, mode, err)
+	}
+	if _, err := ParseAckMode("later"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func newAckModeTestWorker(mode AckMode) (*consumerPollingWorker, *[]*Message) {
+	var (
+		received []*Message
+		consumer = newTestConsumer(&Config{AckMode: mode})
+	)
+	consumer.MessageHandler = func(msg *Message) {
+		received = append(received, msg)
+	}
+	return newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000)), &received
+}
+
+func TestConsumerPollingWorker_AutoAck(t *testing.T) {
+	worker, received := newAckModeTestWorker(AutoAck)
+
+	worker.processData(newXLogDataTestMessage(LSN(0x2000), "order"))
+	if len(*received) != 1 || !(*received)[0].HasResponded() {
+		t.Fatalf("expected the message to be acknowledged")
+	}
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x2000) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x2000), p.Flushed)
+	}
+
+	worker.processData(newKeepaliveTestMessage(LSN(0x3000)))
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x3000) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x3000), p.Flushed)
+	}
+}
+
+func TestConsumerPollingWorker_ManualAck(t *testing.T) {
+	worker, received := newAckModeTestWorker(ManualAck)
+
+	worker.processData(newXLogDataTestMessage(LSN(0x2000), "order"))
+	worker.processData(newXLogDataTestMessage(LSN(0x2100), "order"))
+	worker.processData(newKeepaliveTestMessage(LSN(0x3000)))
+
+	if len(*received) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(*received))
+	}
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x1000) || p.Received != LSN(0x3000) {
+		t.Errorf("expected flushed %s before the ack, got %+v", LSN(0x1000), p)
+	}
+	if n := worker.tracker.Pending(); n != 2 {
+		t.Errorf("expected 2 pending acks, got %d", n)
+	}
+
+	// the second message alone does not move past the first one
+	second := (*received)[1]
+	second.Delegate.OnAck(second)
+	worker.sendAcks()
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x1000) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x1000), p.Flushed)
+	}
+
+	first := (*received)[0]
+	first.Delegate.OnAck(first)
+	worker.sendAcks()
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x2100) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x2100), p.Flushed)
+	}
+
+	// acknowledging twice is ignored
+	first.Delegate.OnAck(first)
+	if n := worker.tracker.Pending(); n != 0 {
+		t.Errorf("expected no pending acks, got %d", n)
+	}
+}
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"sync"
+)
+
+type ackEntry struct {
+	lsn   LSN
+	acked bool
+}
+
+// ackTracker records the messages delivered on a slot and computes the
+// highest LSN below which every message has been acknowledged.
+type ackTracker struct {
+	pending   []*ackEntry
+	watermark LSN
+
+	mutex sync.Mutex
+}
+
+func newAckTracker(lsn LSN) *ackTracker {
+	return &ackTracker{
+		watermark: lsn,
+	}
+}
+
+func (t *ackTracker) Pending() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var n int
+	for _, e := range t.pending {
+		if !e.acked {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *ackTracker) OldestUnacked() (LSN, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, e := range t.pending {
+		if !e.acked {
+			return e.lsn, true
+		}
+	}
+	return 0, false
+}
+
+func (t *ackTracker) Watermark() LSN {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.watermark
+}
+
+func (t *ackTracker) track(lsn LSN) *ackEntry {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry := &ackEntry{lsn: lsn}
+	t.pending = append(t.pending, entry)
+	return entry
+}
+
+// ack marks the entry acknowledged and reports the new watermark when it
+// has advanced.
+func (t *ackTracker) ack(entry *ackEntry) (LSN, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry.acked = true
+
+	var advanced bool
+	for len(t.pending) > 0 && t.pending[0].acked {
+		if t.pending[0].lsn > t.watermark {
+			t.watermark = t.pending[0].lsn
+			advanced = true
+		}
+		t.pending[0] = nil
+		t.pending = t.pending[1:]
+	}
+	return t.watermark, advanced
+}
+
+func (t *ackTracker) reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i := range t.pending {
+		t.pending[i].acked = true
+	}
+	t.pending = nil
+}
@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestAckTracker(t *testing.T) {
+	var (
+		tracker = newAckTracker(100)
+		a       = tracker.track(110)
+		b       = tracker.track(120)
+		c       = tracker.track(130)
+	)
+
+	if n := tracker.Pending(); n != 3 {
+		t.Fatalf("expected 3 pending, got %d", n)
+	}
+
+	// out of order ack must not skip over 110
+	if _, ok := tracker.ack(c); ok {
+		t.Fatal("expected the watermark to stay")
+	}
+	if lsn, ok := tracker.OldestUnacked(); !ok || lsn != 110 {
+		t.Errorf("expected oldest unacked 110, got %d", lsn)
+	}
+
+	if lsn, ok := tracker.ack(a); !ok || lsn != 110 {
+		t.Errorf("expected watermark 110, got %d (%v)", lsn, ok)
+	}
+	if lsn, ok := tracker.ack(b); !ok || lsn != 130 {
+		t.Errorf("expected watermark 130, got %d (%v)", lsn, ok)
+	}
+	if n := tracker.Pending(); n != 0 {
+		t.Errorf("expected 0 pending, got %d", n)
+	}
+	if _, ok := tracker.OldestUnacked(); ok {
+		t.Error("expected no unacked message")
+	}
+}
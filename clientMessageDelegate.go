@@ -3,7 +3,7 @@ package postgres
 var _ MessageDelegate = new(clientMessageDelegate)
 
 type clientMessageDelegate struct {
-	client *Consumer
+	worker *consumerPollingWorker
 }
 
 // OnAck implements MessageDelegate.
@@ -12,8 +12,6 @@ func (d *clientMessageDelegate) OnAck(msg *Message) {
 		return
 	}
 
-	err := d.client.doAck(msg.consumedXLogPos)
-	if err != nil {
-		d.client.Logger.Printf("SendStandbyStatusUpdate failed on (%s#%s): %+v", msg.Slot, msg.consumedXLogPos, err)
-	}
+	// acks are sent by the worker owning the slot's connection
+	d.worker.acknowledge(msg)
 }
@@ -0,0 +1,16 @@
+package postgres
+
+var _ TransactionDelegate = new(clientTransactionDelegate)
+
+type clientTransactionDelegate struct {
+	worker *consumerPollingWorker
+}
+
+// OnAck implements TransactionDelegate.
+func (d *clientTransactionDelegate) OnAck(tx *Transaction) {
+	if !tx.canAck() {
+		return
+	}
+
+	d.worker.acknowledgeTransaction(tx)
+}
@@ -0,0 +1,25 @@
+package postgres
+
+var _ Event = ClusterChangedEvent{}
+
+// ClusterChangedEvent is emitted when a reconnect lands on a server
+// whose system identifier or timeline differs from the previous one,
+// e.g. after a failover.
+type ClusterChangedEvent struct {
+	Slot             string
+	PreviousSystemID string
+	PreviousTimeline int32
+	SystemID         string
+	Timeline         int32
+}
+
+// ByteID implements Event.
+func (e ClusterChangedEvent) ByteID() byte {
+	return ClusterChangedEventByteID
+}
+
+// SystemChanged reports whether the new server belongs to a different
+// cluster rather than a promoted standby of the same one.
+func (e ClusterChangedEvent) SystemChanged() bool {
+	return e.PreviousSystemID != e.SystemID
+}
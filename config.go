@@ -1,10 +1,27 @@
 package postgres
 
 import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Config struct {
+	// ConnString is a postgres:// URL or a libpq keyword/value string.
+	// When it is set, Host, Hosts, Port, Database, User, Password and the
+	// SSL settings are ignored, and PG* environment variables, the
+	// password file and the service file fill in whatever the string
+	// leaves out. replication=database is always enforced, and a non-empty
+	// TargetSessionAttrs overrides target_session_attrs.
+	ConnString string
+
 	Host           string
 	Port           uint16
 	Database       string
@@ -12,18 +29,268 @@ type Config struct {
 	Password       string
 	ConnectTimeout time.Duration
 	PollingTimeout time.Duration
+	AckMode        AckMode
+	// PoisonMessagePolicy decides what happens to a message whose
+	// handler panics.
+	PoisonMessagePolicy PoisonMessagePolicy
+
+	// Hosts lists candidate servers as "host" or "host:port"; entries
+	// without a port use Port. When it is set, Host is ignored and
+	// TargetSessionAttrs decides which server is accepted.
+	Hosts              []string
+	TargetSessionAttrs TargetSessionAttrs
+
+	// SSLMode, SSLRootCert, SSLCert, SSLKey and SSLPassword follow the
+	// libpq sslmode, sslrootcert, sslcert, sslkey and sslpassword
+	// parameters. TLSConfig, when set, replaces the TLS configuration
+	// derived from them and makes TLS mandatory.
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+	SSLPassword string
+	TLSConfig   *tls.Config
+
+	// TransactionMaxMemory is the number of WAL bytes a transaction
+	// delivered to Consumer.TransactionHandler may buffer in memory before
+	// it spills to TransactionSpillDir. Negative disables spilling.
+	TransactionMaxMemory int
+	TransactionSpillDir  string
+
+	// ReconnectBackoff is the delay before the first reconnect attempt
+	// after the walsender connection is lost. It doubles after every
+	// failed attempt up to ReconnectMaxBackoff.
+	ReconnectBackoff     time.Duration
+	ReconnectMaxBackoff  time.Duration
+	ReconnectMaxAttempts int // 0 means retry forever; negative disables reconnecting
 
 	ReplicationOptions []ReplicationOption
+
+	// CreateSlotIfMissing, when set, makes Subscribe create the slots
+	// that do not exist from this template, with SlotName replaced by the
+	// slot name. Otherwise a missing slot fails Subscribe with
+	// ErrSlotNotFound.
+	CreateSlotIfMissing *CreateReplicationSlotSource
 }
 
-func (c *Config) init() {
-	if len(c.Host) == 0 {
-		c.Host = "127.0.0.1"
+// ConfigFromURL returns a Config that connects with the given
+// connection string. See Config.ConnString.
+func ConfigFromURL(connString string) (*Config, error) {
+	var config = &Config{ConnString: connString}
+	if _, _, err := config.pgconnConfig(); err != nil {
+		return nil, err
 	}
-	if c.Port == 0 {
-		c.Port = 5432
+	return config, nil
+}
+
+func (c *Config) init() {
+	if len(c.ConnString) == 0 {
+		if len(c.Host) == 0 {
+			c.Host = "127.0.0.1"
+		}
+		if c.Port == 0 {
+			c.Port = 5432
+		}
 	}
 	if c.PollingTimeout < 0 {
 		c.PollingTimeout = 0
 	}
+	if c.TransactionMaxMemory == 0 {
+		c.TransactionMaxMemory = DefaultTransactionMaxMemory
+	}
+	if len(c.TransactionSpillDir) == 0 {
+		c.TransactionSpillDir = os.TempDir()
+	}
+	if c.ReconnectBackoff <= 0 {
+		c.ReconnectBackoff = DefaultReconnectBackoff
+	}
+	if c.ReconnectMaxBackoff <= 0 {
+		c.ReconnectMaxBackoff = DefaultReconnectMaxBackoff
+	}
+	if c.ReconnectMaxBackoff < c.ReconnectBackoff {
+		c.ReconnectMaxBackoff = c.ReconnectBackoff
+	}
+}
+
+func (c *Config) pgconnConfig() (*pgconn.Config, TargetSessionAttrs, error) {
+	var connString = c.ConnString
+	if len(connString) == 0 {
+		connString = c.buildConnString()
+	}
+	connString, err := enforceReplicationParam(connString)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var attrs = c.TargetSessionAttrs
+	if len(attrs) == 0 {
+		attrs, err = lookupTargetSessionAttrs(connString)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	attrs, err = ParseTargetSessionAttrs(string(attrs))
+	if err != nil {
+		return nil, "", err
+	}
+
+	config, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return nil, "", err
+	}
+	if c.ConnectTimeout > 0 {
+		config.ConnectTimeout = c.ConnectTimeout
+	}
+	// replaces the validator pgconn installs for target_session_attrs
+	config.ValidateConnect = attrs.validateConnect()
+
+	if c.TLSConfig != nil {
+		config.TLSConfig = c.tlsConfigFor(config.Host)
+
+		// every host uses TLSConfig; drop the plaintext fallbacks
+		var (
+			seen      = map[string]bool{net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))): true}
+			fallbacks []*pgconn.FallbackConfig
+		)
+		for _, fb := range config.Fallbacks {
+			addr := net.JoinHostPort(fb.Host, strconv.Itoa(int(fb.Port)))
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			fb.TLSConfig = c.tlsConfigFor(fb.Host)
+			fallbacks = append(fallbacks, fb)
+		}
+		config.Fallbacks = fallbacks
+	}
+	return config, attrs, nil
+}
+
+func (c *Config) tlsConfigFor(host string) *tls.Config {
+	tlsConfig := c.TLSConfig.Clone()
+	if len(tlsConfig.ServerName) == 0 {
+		tlsConfig.ServerName = host
+	}
+	return tlsConfig
+}
+
+func (c *Config) buildConnString() string {
+	var params = url.Values{}
+	if len(c.SSLMode) > 0 {
+		params.Set("sslmode", c.SSLMode)
+	}
+	if len(c.SSLRootCert) > 0 {
+		params.Set("sslrootcert", c.SSLRootCert)
+	}
+	if len(c.SSLCert) > 0 {
+		params.Set("sslcert", c.SSLCert)
+	}
+	if len(c.SSLKey) > 0 {
+		params.Set("sslkey", c.SSLKey)
+	}
+	if len(c.SSLPassword) > 0 {
+		params.Set("sslpassword", c.SSLPassword)
+	}
+
+	var hosts = []string{net.JoinHostPort(c.Host, strconv.Itoa(int(c.Port)))}
+	if len(c.Hosts) > 0 {
+		hosts = hosts[:0]
+		for _, h := range c.Hosts {
+			host, port, err := net.SplitHostPort(h)
+			if err != nil {
+				host, port = strings.Trim(h, "[]"), strconv.Itoa(int(c.Port))
+			}
+			hosts = append(hosts, net.JoinHostPort(host, port))
+		}
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		Host:     strings.Join(hosts, ","),
+		Path:     "/" + c.Database,
+		RawQuery: params.Encode(),
+	}
+	switch {
+	case len(c.Password) > 0:
+		dsn.User = url.UserPassword(c.User, c.Password)
+	case len(c.User) > 0:
+		dsn.User = url.User(c.User)
+	}
+	return dsn.String()
+}
+
+// connStringSettings returns the keywords of a URL or keyword/value
+// connection string, read the way pgconn.ParseConfig reads them.
+func connStringSettings(connString string) (map[string]string, error) {
+	var settings = make(map[string]string)
+
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection string: %w", err)
+		}
+		for k, v := range u.Query() {
+			settings[k] = v[0]
+		}
+		return settings, nil
+	}
+
+	var s = strings.TrimSpace(connString)
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid connection string: missing '=' after '%s'", s)
+		}
+		key := strings.TrimSpace(s[:i])
+		s = strings.TrimLeft(s[i+1:], " \t\n\r\v\f")
+
+		var (
+			value  strings.Builder
+			quoted = strings.HasPrefix(s, "'")
+		)
+		if quoted {
+			s = s[1:]
+		}
+		for len(s) > 0 {
+			ch := s[0]
+			if quoted && ch == '\'' || !quoted && strings.IndexByte(" \t\n\r\v\f", ch) >= 0 {
+				break
+			}
+			if ch == '\\' && len(s) > 1 {
+				s = s[1:]
+				ch = s[0]
+			}
+			value.WriteByte(ch)
+			s = s[1:]
+		}
+		if quoted {
+			if len(s) == 0 {
+				return nil, fmt.Errorf("invalid connection string: unterminated quoted value of '%s'", key)
+			}
+			s = s[1:]
+		}
+		if len(key) == 0 {
+			return nil, fmt.Errorf("invalid connection string: missing keyword")
+		}
+		settings[key] = value.String()
+		s = strings.TrimLeft(s, " \t\n\r\v\f")
+	}
+	return settings, nil
+}
+
+// enforceReplicationParam sets replication=database on a URL or a
+// keyword/value connection string.
+func enforceReplicationParam(connString string) (string, error) {
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return "", fmt.Errorf("invalid connection string: %w", err)
+		}
+		query := u.Query()
+		query.Set("replication", "database")
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+	// the last occurrence of a keyword wins
+	return strings.TrimSpace(connString + " replication=database"), nil
 }
@@ -5,23 +5,40 @@ import (
 	"fmt"
 	"log"
 	"sync"
-	"time"
 
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgproto3"
 )
 
 type Consumer struct {
 	MessageHandler MessageHandleProc
-	EventHandler   EventHandleProc
-	ErrorHandler   ErrorHandleProc
-	Logger         *log.Logger
-	Config         *Config
-
-	conn  *pgconn.PgConn
-	slots map[string]ReplicationSlotSource
-	wg    sync.WaitGroup
+	// TransactionHandler receives whole transactions instead of single
+	// messages. It requires a Decoder and takes precedence over
+	// MessageHandler.
+	TransactionHandler TransactionHandleProc
+	EventHandler       EventHandleProc
+	// ErrorHandler receives the errors of the slots and decides how the
+	// slot goes on; see ErrorDecision. Without it errors are logged and
+	// handled as ErrorContinue.
+	ErrorHandler ErrorHandleProc
+	// DeadLetterHandler receives the poison messages under
+	// PoisonMessageDeadLetter.
+	DeadLetterHandler DeadLetterHandleProc
+	Decoder           MessageDecoder
+	Logger            *log.Logger
+	Config            *Config
+	// SlotMonitor, when set, watches the subscribed slots while the
+	// Consumer runs. Its Config, Slots, EventHandler and Logger default to
+	// the Consumer's, and failures of its EventHandler go to the
+	// ErrorHandler.
+	SlotMonitor *SlotMonitor
+
+	slots   map[string]ReplicationSlotSource
+	workers []*consumerPollingWorker
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	stopped chan struct{}
 
 	mutex       sync.Mutex
 	initialized bool
@@ -31,59 +48,151 @@ type Consumer struct {
 }
 
 func (c *Consumer) Subscribe(slots ...SlotOffsetInfo) error {
+	return c.SubscribeContext(context.Background(), slots...)
+}
+
+// SubscribeContext starts streaming the specified slots. The ctx bounds
+// the startup and the lifetime of the Consumer; cancelling it stops the
+// Consumer like Close does.
+func (c *Consumer) SubscribeContext(ctx context.Context, slots ...SlotOffsetInfo) error {
 	if c.disposed {
-		return fmt.Errorf("the Consumer has been disposed")
+		return ErrConsumerDisposed
 	}
 	if c.running {
-		return fmt.Errorf("the Consumer is running")
+		return ErrConsumerRunning
 	}
 
 	var err error
 	c.mutex.Lock()
 	defer func() {
 		if err != nil {
+			c.cancel(err)
 			c.running = false
 			c.disposed = true
+			close(c.stopped)
 		}
 		c.mutex.Unlock()
 	}()
 	c.init()
 	c.running = true
 	c.pausing = false
+	c.ctx, c.cancel = context.WithCancelCause(ctx)
+	if c.stopped == nil {
+		c.stopped = make(chan struct{})
+	}
 
 	// new slots
 	c.slots = make(map[string]ReplicationSlotSource)
 
-	// new conn
-	{
-		conn, err := NewConn(c.Config)
-		if err != nil {
-			return err
-		}
+	err = c.subscribe(slots...)
+	if err != nil {
+		return err
+	}
+	c.startSlotMonitor()
+
+	go c.supervise()
+	return nil
+}
 
-		c.conn = conn
+// Run subscribes the specified slots and blocks until the Consumer
+// stops. It returns the reason the Consumer stopped.
+func (c *Consumer) Run(ctx context.Context, slots ...SlotOffsetInfo) error {
+	err := c.SubscribeContext(ctx, slots...)
+	if err != nil {
+		return err
 	}
 
-	return c.subscribe(slots...)
+	<-c.stopped
+	return c.Err()
 }
 
 func (c *Consumer) Close() {
-	if c.disposed {
-		return
-	}
+	c.CloseContext(context.Background())
+}
 
+// CloseContext stops the Consumer and waits until the in-flight handlers
+// are drained and the connections are closed, or ctx is done.
+func (c *Consumer) CloseContext(ctx context.Context) error {
 	c.mutex.Lock()
-	c.running = false
-
-	defer func() {
+	if c.disposed || c.cancel == nil {
 		c.disposed = true
-		// dispose
 		c.mutex.Unlock()
-	}()
+		return nil
+	}
+	c.cancel(ErrConsumerClosed)
+	stopped := c.stopped
+	c.mutex.Unlock()
 
-	c.wg.Wait()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed when the Consumer has stopped.
+func (c *Consumer) Done() <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped == nil {
+		c.stopped = make(chan struct{})
+	}
+	return c.stopped
+}
+
+// Err returns the reason the Consumer stopped, or nil if it is running.
+func (c *Consumer) Err() error {
+	if c.ctx == nil || c.ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(c.ctx)
+}
+
+// Progress returns the received, flushed and applied positions of the
+// specified slot.
+func (c *Consumer) Progress(slot string) (SlotProgress, bool) {
+	if w := c.worker(slot); w != nil {
+		return w.progress.Progress(), true
+	}
+	return SlotProgress{}, false
+}
+
+// PendingAcks returns the number of messages delivered on the specified
+// slot that have not been acknowledged yet.
+func (c *Consumer) PendingAcks(slot string) int {
+	if w := c.worker(slot); w != nil {
+		return w.tracker.Pending()
+	}
+	return 0
+}
+
+// OldestUnackedLSN returns the LSN of the oldest message delivered on the
+// specified slot that has not been acknowledged yet.
+func (c *Consumer) OldestUnackedLSN(slot string) (LSN, bool) {
+	if w := c.worker(slot); w != nil {
+		return w.tracker.OldestUnacked()
+	}
+	return 0, false
+}
+
+// IncrementalSnapshot re-reads a table through a subscribed slot without
+// stopping the stream and returns when every chunk has been delivered.
+// It requires a Decoder and a MessageHandler; see IncrementalSnapshot.
+func (c *Consumer) IncrementalSnapshot(ctx context.Context, snapshot IncrementalSnapshot) error {
+	if c.Decoder == nil {
+		return fmt.Errorf("the IncrementalSnapshot requires a MessageDecoder")
+	}
+	if c.MessageHandler == nil {
+		return fmt.Errorf("the IncrementalSnapshot requires a MessageHandler")
+	}
 
-	c.conn.Close(context.Background())
+	w := c.worker(snapshot.Slot)
+	if w == nil {
+		return fmt.Errorf("slot '%s' is not subscribed", snapshot.Slot)
+	}
+	return w.incrementalSnapshot(ctx, snapshot)
 }
 
 func (c *Consumer) Pause() {
@@ -107,140 +216,343 @@ func (c *Consumer) init() {
 		c.Logger = defaultLogger
 	}
 
+	c.Config.init()
+
 	c.initialized = true
 }
 
-func (c *Consumer) doAck(xLogPos pglogrepl.LSN) error {
-	if c.disposed {
+func (c *Consumer) subscribe(slots ...SlotOffsetInfo) error {
+	if len(slots) == 0 {
 		return nil
 	}
-	if !c.running {
-		return nil
+	if c.TransactionHandler != nil && c.Decoder == nil {
+		return fmt.Errorf("the TransactionHandler requires a MessageDecoder")
+	}
+	if c.Config.PoisonMessagePolicy == PoisonMessageDeadLetter && c.DeadLetterHandler == nil {
+		return fmt.Errorf("the PoisonMessageDeadLetter policy requires a DeadLetterHandler")
+	}
+
+	for _, info := range slots {
+		if info.getSlotOffset().snapshot != nil && c.MessageHandler == nil {
+			return fmt.Errorf("the InitialSnapshot requires a MessageHandler")
+		}
 	}
 
-	return pglogrepl.SendStandbyStatusUpdate(context.Background(),
-		c.conn,
-		pglogrepl.StandbyStatusUpdate{
-			WALWritePosition: xLogPos,
-		})
+	var options = pglogrepl.StartReplicationOptions{}
+	for _, opt := range c.Config.ReplicationOptions {
+		opt.applyStartReplicationOptions(&options)
+	}
+
+	var workers []*consumerPollingWorker
+	for _, info := range slots {
+		if err := c.ctx.Err(); err != nil {
+			for _, w := range workers {
+				w.close()
+			}
+			return context.Cause(c.ctx)
+		}
+
+		worker, err := c.startReplication(info.getSlotOffset(), options)
+		if err != nil {
+			for _, w := range workers {
+				w.close()
+			}
+			return err
+		}
+		workers = append(workers, worker)
+	}
+	c.workers = workers
+
+	// start event loop
+	for _, worker := range workers {
+		worker := worker
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+
+			worker.run(c.ctx, c.Config.PollingTimeout)
+		}()
+	}
+	return nil
 }
 
-func (c *Consumer) subscribe(slots ...SlotOffsetInfo) error {
-	if len(slots) == 0 {
-		return nil
+func (c *Consumer) startSlotMonitor() {
+	var m = c.SlotMonitor
+	if m == nil {
+		return
 	}
 
 	var (
-		sysident  pglogrepl.IdentifySystemResult
-		slotnames []string = make([]string, len(slots))
-
-		conn = c.conn
+		config  = m.Config
+		slots   = m.Slots
+		handler = m.EventHandler
 	)
+	if config == nil {
+		config = c.Config
+	}
+	if len(slots) == 0 {
+		for _, w := range c.workers {
+			slots = append(slots, w.Slot)
+		}
+	}
+	if handler == nil {
+		handler = c.EventHandler
+	}
+	if m.Logger == nil {
+		m.Logger = c.Logger
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		m.run(c.ctx, config, slots, handler, c.processSlotMonitorError)
+	}()
+}
 
-	for i, v := range slots {
-		slotnames[i] = v.getSlotOffset().Slot
+// processSlotMonitorError passes a failure of the EventHandler on a
+// SlotMonitor event to the ErrorHandler. The monitor has no stream to
+// retry or stop, so only ErrorStopConsumer has an effect.
+func (c *Consumer) processSlotMonitorError(event Event, err error) {
+	var failure = &ConsumerError{Phase: ErrorPhaseHandle, Err: err}
+	switch e := event.(type) {
+	case *SlotLagWarningEvent:
+		failure.Slot, failure.LSN = e.Slot, e.ConfirmedFlushLSN
+	case *SlotInvalidatedEvent:
+		failure.Slot, failure.LSN = e.Slot, e.ConfirmedFlushLSN
 	}
 
-	// get system info
-	sysident, err := pglogrepl.IdentifySystem(context.Background(), conn)
-	if err != nil {
-		return err
+	if c.ErrorHandler == nil {
+		c.Logger.Printf("SlotMonitor EventHandler failed: %+v", failure)
+		return
 	}
-	c.Logger.Println(
-		"SystemID:", sysident.SystemID,
-		"Timeline:", sysident.Timeline,
-		"XLogPos:", sysident.XLogPos,
-		"DBName:", sysident.DBName)
+	var decision = ErrorContinue
+	if err := protect(func() { decision = c.ErrorHandler(failure) }); err != nil {
+		c.Logger.Printf("ErrorHandler failed on %+v: %+v", failure, err)
+		decision = ErrorStopConsumer
+	}
+	if decision == ErrorStopConsumer {
+		c.stop(failure)
+	}
+}
 
-	// get slot info
-	slotRecords, err := SelectReplicationSlot(context.Background(), conn, slotnames)
-	if err != nil {
-		return err
+func (c *Consumer) worker(slot string) *consumerPollingWorker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, w := range c.workers {
+		if w.Slot == slot {
+			return w
+		}
 	}
-	for _, r := range slotRecords {
-		c.slots[r.SlotName] = r
+	return nil
+}
+
+func (c *Consumer) supervise() {
+	<-c.ctx.Done()
+
+	c.mutex.Lock()
+	c.running = false
+	c.mutex.Unlock()
+
+	// drain workers and in-flight handlers
+	c.wg.Wait()
+
+	c.mutex.Lock()
+	c.disposed = true
+	close(c.stopped)
+	c.mutex.Unlock()
+}
+
+func (c *Consumer) stop(cause error) {
+	c.cancel(cause)
+}
+
+func (c *Consumer) startReplication(slot SlotOffset, options pglogrepl.StartReplicationOptions) (*consumerPollingWorker, error) {
+	// each slot streams on its own walsender
+	conn, sysident, source, err := c.connectSlot(c.ctx, slot.Slot)
+	if err != nil {
+		return nil, err
 	}
 
-	// update startLSN for all slots
-	for _, info := range slots {
-		var (
-			slot   = info.getSlotOffset()
-			source = c.slots[slot.Slot]
-		)
-
-		switch slot.LSN {
-		case StreamUnspecifiedOffset:
-			source.startLSN = source.ConfirmedFlushLSN
-		case StreamZeroOffset:
-			source.startLSN = pglogrepl.LSN(0)
-		case StreamNeverDeliveredOffset:
-			source.startLSN = sysident.XLogPos
-		default:
-			lsn, err := pglogrepl.ParseLSN(slot.LSN)
-			if err != nil {
-				return err
-			}
-			source.startLSN = lsn
+	var ok bool
+	defer func() {
+		if !ok {
+			conn.Close(context.Background())
+		}
+	}()
+
+	var snapshot *snapshotLoad
+	switch {
+	case len(source.SlotName) > 0:
+		if err = validateSlot(source, sysident.DBName, options.Mode); err != nil {
+			return nil, err
+		}
+	case slot.snapshot != nil:
+		// a new slot exports the snapshot its initial load is read in
+		result, err := createReplicationSlot(c.ctx, conn, slot.snapshot.createSource())
+		if err != nil {
+			return nil, err
+		}
+		source = ReplicationSlotSource{
+			SlotName:          slot.Slot,
+			Plugin:            result.OutputPlugin,
+			SlotType:          LogicalReplication,
+			Database:          sysident.DBName,
+			Temporary:         slot.snapshot.Temporary,
+			RestartLSN:        result.ConsistentPoint,
+			ConfirmedFlushLSN: result.ConsistentPoint,
+		}
+		snapshot = &snapshotLoad{
+			InitialSnapshot: slot.snapshot,
+			name:            result.SnapshotName,
+			consistentPoint: result.ConsistentPoint,
+		}
+	case c.Config.CreateSlotIfMissing != nil:
+		source, err = c.createMissingSlot(conn, slot.Slot, sysident.DBName, options.Mode)
+		if err != nil {
+			return nil, err
 		}
-		c.slots[slot.Slot] = source
+	default:
+		return nil, &SlotError{Slot: slot.Slot, Err: ErrSlotNotFound}
 	}
 
-	var options = pglogrepl.StartReplicationOptions{}
-	for _, opt := range c.Config.ReplicationOptions {
-		opt.applyStartReplicationOptions(&options)
+	// update startLSN
+	switch slot.LSN {
+	case StreamUnspecifiedOffset:
+		source.startLSN = source.ConfirmedFlushLSN
+	case StreamZeroOffset:
+		source.startLSN = pglogrepl.LSN(0)
+	case StreamNeverDeliveredOffset:
+		source.startLSN = sysident.XLogPos
+	default:
+		lsn, err := pglogrepl.ParseLSN(slot.LSN)
+		if err != nil {
+			return nil, err
+		}
+		source.startLSN = lsn
 	}
+	c.slots[slot.Slot] = source
 
-	// start event loop
-	for slot, source := range c.slots {
+	if snapshot == nil {
 		c.Logger.Printf("StartReplication:: %+v", source)
-		err = pglogrepl.StartReplication(context.Background(), c.conn,
-			slot,
+		err = pglogrepl.StartReplication(c.ctx, conn,
+			slot.Slot,
 			source.startLSN,
 			options)
 		if err != nil {
-			return err
+			return nil, err
 		}
+	}
+
+	// the server never streams below confirmed_flush_lsn
+	var startProgress = source.startLSN
+	if source.ConfirmedFlushLSN > startProgress {
+		startProgress = source.ConfirmedFlushLSN
+	}
+
+	worker := newConsumerPollingWorker(c, slot.Slot, conn, startProgress)
+	worker.options = options
+	worker.DBName = sysident.DBName
+	worker.SystemID = sysident.SystemID
+	worker.Timeline = sysident.Timeline
+	worker.snapshot = snapshot
+
+	ok = true
+	return worker, nil
+}
 
-		worker := &consumerPollingWorker{
-			consumer:       c,
-			Slot:           slot,
-			DBName:         sysident.DBName,
-			SystemID:       sysident.SystemID,
-			MessageHandler: c.MessageHandler,
-			EventHandler:   c.EventHandler,
-			ErrorHandler:   c.ErrorHandler,
-			Logger:         c.Logger,
-			lastFlushLSN:   source.startLSN,
+// createMissingSlot creates the slot from Config.CreateSlotIfMissing.
+func (c *Consumer) createMissingSlot(conn *pgconn.PgConn, slot string, database string, mode ReplicationMode) (ReplicationSlotSource, error) {
+	var template = *c.Config.CreateSlotIfMissing
+	template.SlotName = slot
+	if template.SlotType != mode {
+		return ReplicationSlotSource{}, &SlotError{
+			Slot:   slot,
+			Detail: fmt.Sprintf("the template creates a %s slot for %s replication", template.SlotType, mode),
+			Err:    ErrSlotTypeMismatch,
 		}
+	}
+	// the slot streams right away; nothing imports a snapshot
+	template.SnapshotAction = ""
+	if template.SlotType == LogicalReplication {
+		template.SnapshotAction = NoExportSnapshot
+	}
 
-		// event loop
-		c.wg.Add(1)
-		go func() {
-			defer c.wg.Done()
+	result, err := createReplicationSlot(c.ctx, conn, template)
+	if err != nil {
+		return ReplicationSlotSource{}, &SlotError{Slot: slot, Detail: "creating the missing slot", Err: err}
+	}
+	c.Logger.Printf("CreateReplicationSlot:: %+v", result)
+
+	var source = ReplicationSlotSource{
+		SlotName:          slot,
+		Plugin:            result.OutputPlugin,
+		SlotType:          template.SlotType,
+		Temporary:         template.Temporary,
+		RestartLSN:        result.ConsistentPoint,
+		ConfirmedFlushLSN: result.ConsistentPoint,
+	}
+	if source.SlotType == LogicalReplication {
+		source.Database = database
+	}
+	return source, nil
+}
 
-			worker.run(c.Config.PollingTimeout)
-		}()
+// validateSlot checks that the existing slot can be streamed from
+// database with the replication mode.
+func validateSlot(source ReplicationSlotSource, database string, mode ReplicationMode) error {
+	var fail = func(err error, detail string) error {
+		return &SlotError{Slot: source.SlotName, Detail: detail, Err: err}
+	}
+
+	switch {
+	case source.SlotType != mode:
+		return fail(ErrSlotTypeMismatch, fmt.Sprintf("%s slot for %s replication", source.SlotType, mode))
+	case source.SlotType == LogicalReplication && source.Database != database:
+		return fail(ErrSlotDatabaseMismatch, fmt.Sprintf("database is '%s', want '%s'", source.Database, database))
+	case source.WALStatus == WALStatusLost:
+		return fail(ErrSlotInvalidated, "wal_status is lost")
+	case source.Active:
+		return fail(ErrSlotActive, "")
 	}
 	return nil
 }
 
-func (c *Consumer) read(deadline time.Time) (*pgproto3.CopyData, error) {
-	var (
-		conn = c.conn
-	)
+func (c *Consumer) connectSlot(ctx context.Context, slot string) (conn *pgconn.PgConn, sysident pglogrepl.IdentifySystemResult, source ReplicationSlotSource, err error) {
+	conn, err = NewConnContext(ctx, c.Config)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			conn.Close(context.Background())
+			conn = nil
+		}
+	}()
 
-	ctx, cancel := context.WithDeadline(context.Background(), deadline)
-	rawMsg, err := conn.ReceiveMessage(ctx)
-	cancel()
+	// get system info
+	sysident, err = pglogrepl.IdentifySystem(ctx, conn)
 	if err != nil {
-		return nil, err
+		return
 	}
-	if errMsg, ok := rawMsg.(*pgproto3.ErrorResponse); ok {
-		return nil, fmt.Errorf("received Postgres WAL error: %+v", errMsg)
+	c.Logger.Println(
+		"Slot:", slot,
+		"SystemID:", sysident.SystemID,
+		"Timeline:", sysident.Timeline,
+		"XLogPos:", sysident.XLogPos,
+		"DBName:", sysident.DBName)
+
+	// get slot info
+	slotRecords, err := SelectReplicationSlot(ctx, conn, []string{slot})
+	if err != nil {
+		return
 	}
-	msg, ok := rawMsg.(*pgproto3.CopyData)
-	if !ok {
-		return nil, nil
+	for _, r := range slotRecords {
+		if r.SlotName == slot {
+			source = r
+		}
 	}
-	return msg, nil
+	return
 }
@@ -0,0 +1,67 @@
+package postgres
+
+import "fmt"
+
+type ErrorPhase string
+
+const (
+	// ErrorPhaseRead is a failure to receive the stream or to read the
+	// tables of an InitialSnapshot.
+	ErrorPhaseRead ErrorPhase = "read"
+	// ErrorPhaseParse is WAL data that cannot be parsed or decoded.
+	ErrorPhaseParse ErrorPhase = "parse"
+	// ErrorPhaseHandle is a failure while delivering data, e.g. an error
+	// returned by the EventHandler or a transaction that cannot be
+	// buffered.
+	ErrorPhaseHandle ErrorPhase = "handle"
+	// ErrorPhaseAck is a standby status update that cannot be sent.
+	ErrorPhaseAck ErrorPhase = "ack"
+)
+
+// ErrorDecision tells the worker of a slot how to go on after an error.
+type ErrorDecision int
+
+const (
+	// ErrorContinue skips the failing data and goes on with the stream.
+	// A stream that cannot be read any more is reconnected as Retry, and
+	// an InitialSnapshot that cannot be read stops the Consumer.
+	ErrorContinue ErrorDecision = iota
+	// ErrorRetry reconnects the slot and resumes streaming from the last
+	// flushed position, so the failing data is received again.
+	ErrorRetry
+	// ErrorStopSlot stops streaming the slot; the other slots go on.
+	ErrorStopSlot
+	// ErrorStopConsumer stops the Consumer with the error as cause.
+	ErrorStopConsumer
+)
+
+func (d ErrorDecision) String() string {
+	switch d {
+	case ErrorContinue:
+		return "continue"
+	case ErrorRetry:
+		return "retry"
+	case ErrorStopSlot:
+		return "stop slot"
+	case ErrorStopConsumer:
+		return "stop consumer"
+	}
+	return fmt.Sprintf("ErrorDecision(%d)", int(d))
+}
+
+// ConsumerError is the error a Consumer passes to its ErrorHandler. Err
+// is e.g. a *WALError, *DecodeError or *AckError.
+type ConsumerError struct {
+	Slot  string
+	LSN   LSN
+	Phase ErrorPhase
+	Err   error
+}
+
+func (e *ConsumerError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Phase, e.Err)
+}
+
+func (e *ConsumerError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestConsumerPollingWorker_ErrorContinue(t *testing.T) {
+	var (
+		received []*Message
+		consumer = newTestConsumer(nil)
+	)
+	consumer.MessageHandler = func(msg *Message) { received = append(received, msg) }
+	consumer.EventHandler = func(event Event) error { return nil }
+	consumer.Decoder = failingDecoder{err: errors.New("unexpected message")}
+	worker := newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000))
+
+	worker.processData(newXLogDataTestMessage(LSN(0x2000), "?"))
+
+	if !worker.resolveFailure(context.Background()) {
+		t.Fatal("expected the worker to go on")
+	}
+	if len(received) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(received))
+	}
+	if _, err := received[0].Decode(); err == nil {
+		t.Error("expected the decode error on the message")
+	}
+}
+
+func TestConsumerPollingWorker_ErrorStopSlot(t *testing.T) {
+	var (
+		failures []*ConsumerError
+		received []*Message
+		consumer = newTestConsumer(nil)
+	)
+	consumer.MessageHandler = func(msg *Message) { received = append(received, msg) }
+	consumer.ErrorHandler = func(err *ConsumerError) ErrorDecision {
+		failures = append(failures, err)
+		return ErrorStopSlot
+	}
+	consumer.Decoder = failingDecoder{err: errors.New("unexpected message")}
+	worker := newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000))
+
+	worker.processData(newXLogDataTestMessage(LSN(0x2000), "?"))
+
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 error, got %+v", failures)
+	}
+	var (
+		failure   = failures[0]
+		decodeErr *DecodeError
+	)
+	if failure.Slot != "orders" || failure.LSN != LSN(0x2000) || failure.Phase != ErrorPhaseParse || !errors.As(failure, &decodeErr) {
+		t.Errorf("unexpected error %+v", failure)
+	}
+	if len(received) != 0 {
+		t.Errorf("expected no message, got %d", len(received))
+	}
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x1000) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x1000), p.Flushed)
+	}
+	if worker.resolveFailure(context.Background()) {
+		t.Error("expected the slot to stop")
+	}
+	if worker.consumer.ctx.Err() != nil {
+		t.Error("expected the Consumer to go on")
+	}
+}
+
+func TestConsumerPollingWorker_ErrorStopConsumer(t *testing.T) {
+	var (
+		cause    = errors.New("event rejected")
+		consumer = newTestConsumer(nil)
+	)
+	consumer.ErrorHandler = func(err *ConsumerError) ErrorDecision {
+		if err.Phase != ErrorPhaseHandle || !errors.Is(err, cause) {
+			t.Errorf("unexpected error %+v", err)
+		}
+		return ErrorStopConsumer
+	}
+	consumer.EventHandler = func(event Event) error { return cause }
+	worker := newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000))
+
+	worker.processEvent(&ReconnectedEvent{Slot: "orders"})
+
+	if worker.resolveFailure(context.Background()) {
+		t.Fatal("expected the worker to stop")
+	}
+	var failure *ConsumerError
+	if err := context.Cause(worker.consumer.ctx); !errors.As(err, &failure) || !errors.Is(err, cause) {
+		t.Errorf("unexpected cause %v", err)
+	}
+}
@@ -2,62 +2,144 @@ package postgres
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
 )
 
 type consumerPollingWorker struct {
 	consumer *Consumer
+	conn     *pgconn.PgConn
+	options  pglogrepl.StartReplicationOptions
 
 	Slot     string
 	DBName   string
 	SystemID string
+	Timeline int32
 
-	MessageHandler MessageHandleProc
-	EventHandler   EventHandleProc
-	ErrorHandler   ErrorHandleProc
-	Logger         *log.Logger
+	MessageHandler     MessageHandleProc
+	TransactionHandler TransactionHandleProc
+	EventHandler       EventHandleProc
+	ErrorHandler       ErrorHandleProc
+	DeadLetterHandler  DeadLetterHandleProc
+	Decoder            MessageDecoder
+	Logger             *log.Logger
 
-	lastFlushLSN pglogrepl.LSN
+	snapshot    *snapshotLoad
+	window      *snapshotWindow
+	windowMutex sync.Mutex
+	windowBusy  atomic.Bool
+	relations   *RelationCache
+	progress    *slotProgressTracker
+	tracker     *ackTracker
+	transaction *transactionBuffer
+	done        chan struct{}
+
+	// the highest LSN acknowledged since the last drainAcks; handlers may
+	// acknowledge from any goroutine
+	ackMutex sync.Mutex
+	acked    LSN
+
+	// the most severe ErrorDecision taken since the last resolveFailure
+	decision ErrorDecision
+	failure  error
+}
+
+// newConsumerPollingWorker creates the worker streaming slot on conn
+// with the handlers and settings of c. Nothing before startLSN is
+// acknowledged.
+func newConsumerPollingWorker(c *Consumer, slot string, conn *pgconn.PgConn, startLSN LSN) *consumerPollingWorker {
+	return &consumerPollingWorker{
+		consumer:           c,
+		conn:               conn,
+		Slot:               slot,
+		MessageHandler:     c.MessageHandler,
+		TransactionHandler: c.TransactionHandler,
+		EventHandler:       c.EventHandler,
+		ErrorHandler:       c.ErrorHandler,
+		DeadLetterHandler:  c.DeadLetterHandler,
+		Decoder:            c.Decoder,
+		Logger:             c.Logger,
+		relations:          NewRelationCache(),
+		done:               make(chan struct{}),
+		progress:           newSlotProgressTracker(startLSN),
+		tracker:            newAckTracker(startLSN),
+		transaction: &transactionBuffer{
+			maxMemory: c.Config.TransactionMaxMemory,
+			spillDir:  c.Config.TransactionSpillDir,
+		},
+	}
 }
 
-func (w *consumerPollingWorker) run(timeout time.Duration) {
+func (w *consumerPollingWorker) run(ctx context.Context, timeout time.Duration) {
 	var (
 		consumer = w.consumer
 		deadline time.Time
 	)
+	defer func() {
+		close(w.done)
+		w.shutdown()
+	}()
 
-	for consumer.running {
-		if consumer.pausing {
-			ctx, _ := context.WithTimeout(context.Background(), timeout)
+	if w.snapshot != nil {
+		if err := w.loadSnapshot(ctx); err != nil {
+			// a poison row has been dealt with already
+			if ctx.Err() == nil && !w.failing() {
+				err = fmt.Errorf("load snapshot of slot '%s': %w", w.Slot, err)
+				// there is nothing to continue without the snapshot
+				if w.processError(ErrorPhaseRead, w.snapshot.consistentPoint, err) != ErrorStopSlot {
+					w.escalate(ErrorStopConsumer, err)
+				}
+			}
+			// the temporary slot of the incomplete snapshot goes with
+			// the connection
+			w.close()
+			w.resolveFailure(ctx)
+			return
+		}
+	}
+
+	for ctx.Err() == nil {
+		w.sendAcks()
+		if !w.resolveFailure(ctx) {
+			break
+		}
 
-			err := consumer.doAck(w.lastFlushLSN)
+		if consumer.pausing {
+			err := w.sendStandbyStatus()
 			if err != nil {
-				w.Logger.Printf("SendStandbyCopyDone error:: %+v", err)
+				w.processError(ErrorPhaseAck, w.progress.Progress().Flushed, err)
 			}
 
-			<-ctx.Done()
+			w.sleep(ctx, timeout)
 			continue
 		}
 
 		deadline = time.Now().Add(timeout)
 
-		msg, err := consumer.read(deadline)
+		msg, err := w.read(ctx, deadline)
 		if err != nil {
-			// ignore any error if disposed or not running
-			if !consumer.running {
+			// ignore any error if the consumer is stopping
+			if ctx.Err() != nil {
 				break
 			}
 			if pgconn.Timeout(err) {
 				continue
 			}
-			if !w.processError(err) {
-				w.Logger.Fatalf("%% Error: %v\n", err)
-				continue
+			if w.processError(ErrorPhaseRead, w.progress.Progress().Received, err) == ErrorContinue {
+				// the stream cannot be resumed on this connection
+				w.escalate(ErrorRetry, err)
+			}
+			if !w.resolveFailure(ctx) {
+				break
 			}
+			continue
 		}
 
 		if msg == nil {
@@ -66,118 +148,821 @@ func (w *consumerPollingWorker) run(timeout time.Duration) {
 		}
 
 		w.processData(msg.Data)
+		if !w.resolveFailure(ctx) {
+			break
+		}
 	}
 }
 
-func (w *consumerPollingWorker) processData(data []byte) {
+// resolveFailure acts on the most severe ErrorDecision taken since the
+// last call; it returns false when the worker has to stop.
+func (w *consumerPollingWorker) resolveFailure(ctx context.Context) bool {
+	var decision, failure = w.decision, w.failure
+	w.decision, w.failure = ErrorContinue, nil
+
+	switch decision {
+	case ErrorRetry:
+		if !w.reconnect(ctx, failure) {
+			if ctx.Err() == nil {
+				w.consumer.stop(fmt.Errorf("stop streaming slot '%s' at %s: %w", w.Slot, w.progress.Progress().Flushed, failure))
+			}
+			return false
+		}
+	case ErrorStopSlot:
+		w.Logger.Printf("stop streaming slot '%s' at %s: %+v", w.Slot, w.progress.Progress().Flushed, failure)
+		return false
+	case ErrorStopConsumer:
+		w.consumer.stop(failure)
+		return false
+	}
+	return true
+}
+
+// escalate records decision unless a more severe one is pending.
+func (w *consumerPollingWorker) escalate(decision ErrorDecision, err error) {
+	if decision > w.decision {
+		w.decision = decision
+		w.failure = err
+	}
+}
+
+// failing reports whether an ErrorDecision other than ErrorContinue is
+// pending; the data being processed is then neither delivered nor
+// acknowledged.
+func (w *consumerPollingWorker) failing() bool {
+	return w.decision != ErrorContinue
+}
+
+// shutdown sends the final standby status update and closes the
+// connection.
+func (w *consumerPollingWorker) shutdown() {
+	w.transaction.discard()
+	if w.conn == nil {
+		return
+	}
+
+	w.sendAcks()
+	if err := w.sendStandbyStatus(); err != nil {
+		w.Logger.Printf("%+v", err)
+	}
+	w.close()
+}
+
+func (w *consumerPollingWorker) reconnect(ctx context.Context, cause error) bool {
 	var (
-		consumer = w.consumer
-		xLogPos  = w.lastFlushLSN
+		config = w.consumer.Config
+		delay  = config.ReconnectBackoff
+	)
+
+	if config.ReconnectMaxAttempts < 0 {
+		return false
+	}
+
+	w.close()
+
+	// resume from the last position acknowledged by the handlers
+	var startLSN = w.progress.Progress().Flushed
+
+	for attempt := 1; config.ReconnectMaxAttempts == 0 || attempt <= config.ReconnectMaxAttempts; attempt++ {
+		w.processEvent(&ReconnectingEvent{
+			Slot:    w.Slot,
+			Attempt: attempt,
+			Delay:   delay,
+			Err:     cause,
+		})
+		if !w.sleep(ctx, delay) {
+			return false
+		}
+
+		conn, sysident, _, err := w.consumer.connectSlot(ctx, w.Slot)
+		if err == nil {
+			err = pglogrepl.StartReplication(ctx, conn,
+				w.Slot,
+				startLSN,
+				w.options)
+			if err != nil {
+				conn.Close(context.Background())
+			}
+		}
+		if err == nil {
+			var (
+				previousSystemID = w.SystemID
+				previousTimeline = w.Timeline
+			)
+			w.conn = conn
+			w.DBName = sysident.DBName
+			w.SystemID = sysident.SystemID
+			w.Timeline = sysident.Timeline
+			// the server resends relation messages and every
+			// unacknowledged message on a new stream
+			w.relations.Reset()
+			w.tracker.reset()
+			w.transaction.discard()
+
+			if previousSystemID != w.SystemID || previousTimeline != w.Timeline {
+				w.Logger.Printf("slot '%s' reconnected to system %s timeline %d (was system %s timeline %d)",
+					w.Slot, w.SystemID, w.Timeline, previousSystemID, previousTimeline)
+				w.processEvent(&ClusterChangedEvent{
+					Slot:             w.Slot,
+					PreviousSystemID: previousSystemID,
+					PreviousTimeline: previousTimeline,
+					SystemID:         w.SystemID,
+					Timeline:         w.Timeline,
+				})
+			}
+			w.processEvent(&ReconnectedEvent{
+				Slot:     w.Slot,
+				Attempt:  attempt,
+				StartLSN: startLSN,
+			})
+			return true
+		}
+
+		w.Logger.Printf("reconnect slot '%s' failed (attempt %d): %+v", w.Slot, attempt, err)
+		cause = err
+		delay *= 2
+		if delay > config.ReconnectMaxBackoff {
+			delay = config.ReconnectMaxBackoff
+		}
+	}
+	return false
+}
+
+// loadSnapshot reads the tables of the initial snapshot and then starts
+// streaming at the slot's consistent point, so every change is either in
+// the snapshot or in the stream.
+func (w *consumerPollingWorker) loadSnapshot(ctx context.Context) (err error) {
+	var (
+		snapshot = w.snapshot
+		started  = time.Now()
+		rows     int
+	)
+
+	conn, err := newQueryConnContext(ctx, w.consumer.Config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	reader := &snapshotReader{
+		conn:      conn,
+		relations: w.relations,
+		batchSize: snapshot.batchSize(),
+	}
+	if err = reader.begin(ctx, snapshot.name); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			reader.rollback(context.Background())
+		}
+	}()
+
+	for _, table := range snapshot.Tables {
+		relation, err := reader.relation(ctx, table)
+		if err != nil {
+			return err
+		}
+		n, err := reader.readTable(ctx, relation, func(read *ReadMessage) error {
+			w.processSnapshotRow(snapshot.consistentPoint, started, read)
+			if w.failing() {
+				return w.failure
+			}
+			return ctx.Err()
+		})
+		rows += n
+		if err != nil {
+			return err
+		}
+	}
+	if err = reader.commit(ctx); err != nil {
+		return err
+	}
+	if !snapshot.Temporary {
+		if err = w.persistSnapshotSlot(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	w.Logger.Printf("StartReplication:: slot '%s' at %s after snapshot '%s' (%d rows)",
+		w.Slot, snapshot.consistentPoint, snapshot.name, rows)
+	err = pglogrepl.StartReplication(ctx, w.conn,
+		w.Slot,
+		snapshot.consistentPoint,
+		w.options)
+	if err != nil {
+		return err
+	}
+	w.snapshot = nil
+
+	w.processEvent(&SnapshotCompletedEvent{
+		Slot:            w.Slot,
+		SnapshotName:    snapshot.name,
+		ConsistentPoint: snapshot.consistentPoint,
+		Tables:          len(snapshot.Tables),
+		Rows:            rows,
+	})
+	return nil
+}
+
+// persistSnapshotSlot copies the temporary slot the snapshot was
+// exported from to the slot, which then starts at the same consistent
+// point, and drops the temporary one.
+func (w *consumerPollingWorker) persistSnapshotSlot(ctx context.Context, conn *pgconn.PgConn) error {
+	var loading = w.snapshot.loadingSlot()
+
+	src, err := conn.EscapeString(loading)
+	if err != nil {
+		return err
+	}
+	dst, err := conn.EscapeString(w.Slot)
+	if err != nil {
+		return err
+	}
+	sql := fmt.Sprintf(__SQL_COPY_REPLICATION_SLOT, "'"+src+"'", "'"+dst+"'")
+	if _, err = conn.Exec(ctx, sql).ReadAll(); err != nil {
+		return err
+	}
+	w.Logger.Printf("CopyReplicationSlot:: slot '%s' from '%s' after its snapshot", w.Slot, loading)
+
+	return pglogrepl.DropReplicationSlot(ctx, w.conn, loading, pglogrepl.DropReplicationSlotOptions{})
+}
+
+func (w *consumerPollingWorker) processSnapshotRow(lsn LSN, ts time.Time, read *ReadMessage) {
+	w.consumer.wg.Add(1)
+	defer w.consumer.wg.Done()
+
+	msg := Message{
+		Slot:            w.Slot,
+		Delegate:        new(snapshotMessageDelegate),
+		consumedXLogPos: lsn,
+		data: &pglogrepl.XLogData{
+			WALStart:     lsn,
+			ServerWALEnd: lsn,
+			ServerTime:   ts,
+		},
+		database:  w.DBName,
+		systemID:  w.SystemID,
+		decoded:   []LogicalMessage{read},
+		decodable: true,
+		snapshot:  true,
+	}
+
+	err := protect(func() { w.MessageHandler(&msg) })
+	if err != nil {
+		w.processPoison(&DeadLetter{Slot: w.Slot, LSN: lsn, Message: &msg, Err: err})
+	}
+	msg.canAck()
+}
+
+// incrementalSnapshot reads the table chunk by chunk and waits for the
+// worker to deliver each chunk when its high watermark is streamed.
+func (w *consumerPollingWorker) incrementalSnapshot(ctx context.Context, snapshot IncrementalSnapshot) error {
+	if !w.windowBusy.CompareAndSwap(false, true) {
+		return fmt.Errorf("slot '%s' is already taking an incremental snapshot", w.Slot)
+	}
+	defer w.windowBusy.Store(false)
+	defer w.setSnapshotWindow(nil)
+
+	conn, err := newQueryConnContext(ctx, w.consumer.Config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	var (
+		limit  = snapshot.chunkSize()
+		reader = &snapshotReader{
+			conn:      conn,
+			relations: w.relations,
+			batchSize: limit,
+		}
+	)
+	relation, err := reader.relation(ctx, snapshot.Table)
+	if err != nil {
+		return err
+	}
+	if len(relation.KeyColumns()) == 0 {
+		return fmt.Errorf("table '%s' has no primary key", relation.QualifiedName())
+	}
+
+	var after Tuple
+	for {
+		window, err := newSnapshotWindow(relation)
+		if err != nil {
+			return err
+		}
+		w.setSnapshotWindow(window)
+
+		if err = reader.emitWatermark(ctx, window.lowWatermark()); err != nil {
+			return err
+		}
+		var rows []*ReadMessage
+		if err = reader.begin(ctx, ""); err != nil {
+			return err
+		}
+		_, err = reader.readChunk(ctx, relation, after, limit, func(read *ReadMessage) error {
+			rows = append(rows, read)
+			return nil
+		})
+		if err != nil {
+			reader.rollback(context.Background())
+			return err
+		}
+		if err = reader.commit(ctx); err != nil {
+			return err
+		}
+		window.setRows(rows)
+		if err = reader.emitWatermark(ctx, window.highWatermark()); err != nil {
+			return err
+		}
+
+		select {
+		case <-window.done:
+		case <-w.done:
+			return fmt.Errorf("slot '%s' stopped during the incremental snapshot of '%s'", w.Slot, relation.QualifiedName())
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if len(rows) < limit {
+			return nil
+		}
+		after = rows[len(rows)-1].New
+	}
+}
+
+func (w *consumerPollingWorker) currentSnapshotWindow() *snapshotWindow {
+	w.windowMutex.Lock()
+	defer w.windowMutex.Unlock()
+
+	return w.window
+}
+
+func (w *consumerPollingWorker) setSnapshotWindow(window *snapshotWindow) {
+	w.windowMutex.Lock()
+	defer w.windowMutex.Unlock()
+
+	w.window = window
+}
+
+// observeSnapshot feeds the streamed messages to the open incremental
+// snapshot window, delivers the chunk when its high watermark arrives and
+// returns the number of watermark messages in msgs.
+func (w *consumerPollingWorker) observeSnapshot(xLogPos LSN, msgs []LogicalMessage) (watermarks int) {
+	var window = w.currentSnapshotWindow()
+	for _, m := range msgs {
+		if !isSnapshotWatermark(m) {
+			if window != nil {
+				window.observe(m)
+			}
+			continue
+		}
+
+		watermarks++
+		if window == nil {
+			continue
+		}
+		switch string(m.(*LogicalDecodingMessage).Content) {
+		case window.lowWatermark():
+			window.begin()
+		case window.highWatermark():
+			if !window.open {
+				continue
+			}
+			window.open = false
+
+			var now = time.Now()
+			for _, r := range window.end() {
+				w.processSnapshotRow(xLogPos, now, r)
+				if w.failing() {
+					break
+				}
+			}
+			close(window.done)
+		}
+	}
+	return watermarks
+}
+
+func isSnapshotWatermark(msg LogicalMessage) bool {
+	m, ok := msg.(*LogicalDecodingMessage)
+	return ok && m.Prefix == SnapshotWatermarkPrefix
+}
+
+func (w *consumerPollingWorker) sleep(ctx context.Context, d time.Duration) bool {
+	var timer = time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return ctx.Err() == nil
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// acknowledge reports the message to the ack tracker and queues the
+// contiguous watermark when it advances.
+func (w *consumerPollingWorker) acknowledge(msg *Message) {
+	if msg.ackEntry == nil {
+		w.ack(msg.consumedXLogPos)
+		return
+	}
+
+	if lsn, ok := w.tracker.ack(msg.ackEntry); ok {
+		w.ack(lsn)
+	}
+}
+
+// pass acknowledges xLogPos on behalf of data no handler receives, so
+// the flush position still waits for the messages delivered before it.
+func (w *consumerPollingWorker) pass(xLogPos pglogrepl.LSN) {
+	if lsn, ok := w.tracker.ack(w.tracker.track(xLogPos)); ok {
+		w.ack(lsn)
+	}
+}
+
+func (w *consumerPollingWorker) acknowledgeTransaction(tx *Transaction) {
+	if lsn, ok := w.tracker.ack(tx.ackEntry); ok {
+		w.ack(lsn)
+	}
+}
+
+// ack records xLogPos for the next standby status update; it never
+// blocks, so handlers can acknowledge on the worker goroutine.
+func (w *consumerPollingWorker) ack(xLogPos pglogrepl.LSN) {
+	w.ackMutex.Lock()
+	defer w.ackMutex.Unlock()
+
+	if xLogPos > w.acked {
+		w.acked = xLogPos
+	}
+}
+
+func (w *consumerPollingWorker) sendAcks() {
+	if w.drainAcks() {
+		if err := w.sendStandbyStatus(); err != nil {
+			w.processError(ErrorPhaseAck, w.progress.Progress().Flushed, err)
+		}
+	}
+}
+
+func (w *consumerPollingWorker) drainAcks() (acked bool) {
+	w.ackMutex.Lock()
+	var xLogPos = w.acked
+	w.acked = 0
+	w.ackMutex.Unlock()
+
+	if xLogPos == 0 {
+		return false
+	}
+	w.progress.flush(xLogPos)
+	return true
+}
+
+func (w *consumerPollingWorker) sendStandbyStatus() error {
+	if w.conn == nil {
+		return nil
+	}
+
+	status := w.progress.standbyStatusUpdate()
+	err := pglogrepl.SendStandbyStatusUpdate(context.Background(), w.conn, status)
+	if err != nil {
+		return &AckError{Slot: w.Slot, LSN: status.WALFlushPosition, Err: err}
+	}
+	return nil
+}
+
+func (w *consumerPollingWorker) read(ctx context.Context, deadline time.Time) (*pgproto3.CopyData, error) {
+	var (
+		conn = w.conn
 	)
 
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	rawMsg, err := conn.ReceiveMessage(ctx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if errMsg, ok := rawMsg.(*pgproto3.ErrorResponse); ok {
+		return nil, &WALError{Slot: w.Slot, LSN: w.progress.Progress().Received, Response: errMsg}
+	}
+	msg, ok := rawMsg.(*pgproto3.CopyData)
+	if !ok {
+		return nil, nil
+	}
+	return msg, nil
+}
+
+func (w *consumerPollingWorker) close() {
+	if w.conn != nil {
+		w.conn.Close(context.Background())
+		w.conn = nil
+	}
+}
+
+func (w *consumerPollingWorker) processData(data []byte) {
 	switch data[0] {
 	case pglogrepl.PrimaryKeepaliveMessageByteID:
 		pkm, err := pglogrepl.ParsePrimaryKeepaliveMessage(data[1:])
 		if err != nil {
-			if !w.processError(err) {
-				w.Logger.Printf("ParsePrimaryKeepaliveMessage() failed on (%s#%s): %+v", w.Slot, xLogPos, err)
-			}
+			var lsn = w.progress.Progress().Received
+			w.processError(ErrorPhaseParse, lsn, &DecodeError{Slot: w.Slot, LSN: lsn, Err: err})
 			break
 		}
 
-		// update XLogPos
-		if pkm.ServerWALEnd > xLogPos {
-			xLogPos = pkm.ServerWALEnd
-		}
-		// if pkm.ReplyRequested {
-		// 	deadline = time.Time{}
-		// }
+		w.progress.receive(pkm.ServerWALEnd)
 
 		ev := PrimaryKeepaliveMessageEvent(pkm)
 		w.processEvent(&ev)
 
-		if xLogPos < pkm.ServerWALEnd {
-			break
+		if w.consumer.Config.AckMode == AutoAck && w.tracker.Pending() == 0 && !w.transaction.active() {
+			// every message received so far has been handled
+			w.progress.apply(pkm.ServerWALEnd)
+			w.progress.flush(pkm.ServerWALEnd)
 		}
 
 		// ack
-		if err = consumer.doAck(xLogPos); err != nil {
-			if !w.processError(err) {
-				w.Logger.Printf("SendStandbyStatusUpdate failed on (%s#%s): %+v", w.Slot, xLogPos, err)
-			}
-			break
+		if err = w.sendStandbyStatus(); err != nil {
+			w.processError(ErrorPhaseAck, w.progress.Progress().Flushed, err)
 		}
-		// update lsn
-		w.lastFlushLSN = xLogPos
 	case pglogrepl.XLogDataByteID:
 		xld, err := pglogrepl.ParseXLogData(data[1:])
 		if err != nil {
-			if !w.processError(err) {
-				w.Logger.Printf("%% Error: %v\n", err)
-			}
+			var lsn = w.progress.Progress().Received
+			w.processError(ErrorPhaseParse, lsn, &DecodeError{Slot: w.Slot, LSN: lsn, Err: err})
 			break
 		}
 
-		// update XLogPos
-		if xld.WALStart > xLogPos {
-			xLogPos = xld.WALStart
+		var xLogPos = xld.WALStart
+		if p := w.progress.Progress(); p.Flushed > xLogPos {
+			xLogPos = p.Flushed
 		}
+		w.progress.receive(xld.WALStart + pglogrepl.LSN(len(xld.WALData)))
 
 		ev := XLogDataEvent(xld)
 		w.processEvent(&ev)
-		w.processMessage(xLogPos, xld)
+		if w.failing() {
+			break
+		}
 
-		if xLogPos < xld.WALStart {
+		var delivered bool
+		if w.TransactionHandler != nil {
+			delivered = w.processTransaction(xLogPos, xld)
+		} else {
+			delivered = w.processMessage(xLogPos, xld)
+		}
+		if w.failing() {
+			// keep the position so a retry receives the data again
 			break
 		}
 
+		switch {
+		case w.transaction.active():
+			// wait for the transaction to commit
+		case delivered:
+			w.progress.apply(xLogPos)
+		default:
+			// nothing was delivered, so there is nothing to wait for
+			w.progress.apply(xLogPos)
+			w.pass(xLogPos)
+		}
+
 		// ack
-		if err = consumer.doAck(xLogPos); err != nil {
-			if !w.processError(err) {
-				w.Logger.Printf("SendStandbyStatusUpdate failed on (%s#%s): %+v", w.Slot, xLogPos, err)
-			}
-			break
+		w.drainAcks()
+		if err = w.sendStandbyStatus(); err != nil {
+			w.processError(ErrorPhaseAck, w.progress.Progress().Flushed, err)
 		}
-		// update lsn
-		w.lastFlushLSN = xLogPos
 	default:
 		// do nothing
 	}
 }
 
-func (w *consumerPollingWorker) processMessage(xLogPos pglogrepl.LSN, data pglogrepl.XLogData) {
+func (w *consumerPollingWorker) processMessage(xLogPos pglogrepl.LSN, data pglogrepl.XLogData) (delivered bool) {
 	if w.MessageHandler != nil {
 		w.consumer.wg.Add(1)
 		defer w.consumer.wg.Done()
 
 		msg := Message{
 			Slot:            w.Slot,
-			Delegate:        &clientMessageDelegate{client: w.consumer},
+			Delegate:        &clientMessageDelegate{worker: w},
 			consumedXLogPos: xLogPos,
 			data:            &data,
 			database:        w.DBName,
 			systemID:        w.SystemID,
 		}
+		w.decodeMessage(&msg)
+		if w.failing() {
+			return false
+		}
+		if n := w.observeSnapshot(xLogPos, msg.decoded); n > 0 && n == len(msg.decoded) {
+			// watermarks are internal to the incremental snapshot
+			w.pass(xLogPos)
+			return true
+		}
+		msg.ackEntry = w.tracker.track(xLogPos)
+
+		err := protect(func() { w.MessageHandler(&msg) })
+		if err != nil {
+			if w.processPoison(&DeadLetter{Slot: w.Slot, LSN: msg.StartLSN(), Message: &msg, Err: err}) {
+				if msg.canAck() {
+					w.acknowledge(&msg)
+				}
+			}
+			return true
+		}
+
+		if w.consumer.Config.AckMode == AutoAck {
+			if msg.canAck() {
+				w.acknowledge(&msg)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (w *consumerPollingWorker) processTransaction(xLogPos pglogrepl.LSN, data pglogrepl.XLogData) (delivered bool) {
+	msgs, err := w.Decoder.Decode(w.relations, data.WALData)
+	if err != nil {
+		w.processError(ErrorPhaseParse, data.WALStart, &DecodeError{Slot: w.Slot, LSN: data.WALStart, Err: err})
+		return false
+	}
+
+	if n := w.observeSnapshot(xLogPos, msgs); n > 0 {
+		if n == len(msgs) && !w.transaction.active() {
+			// watermarks are internal to the incremental snapshot
+			w.pass(xLogPos)
+			return true
+		}
+	}
+
+	var size = len(data.WALData)
+	for _, m := range msgs {
+		if isSnapshotWatermark(m) {
+			continue
+		}
+		switch v := m.(type) {
+		case *BeginMessage:
+			w.transaction.begin(&Transaction{
+				Slot:     w.Slot,
+				Xid:      v.Xid,
+				FinalLSN: v.FinalLSN,
+				database: w.DBName,
+				systemID: w.SystemID,
+			})
+		case *CommitMessage:
+			if !w.transaction.active() {
+				continue
+			}
+			tx := w.transaction.commit()
+			tx.CommitLSN = v.CommitLSN
+			tx.EndLSN = v.TransactionEndLSN
+			tx.CommitTime = v.CommitTime
+			tx.consumedXLogPos = xLogPos
+
+			w.deliverTransaction(tx)
+			if w.failing() {
+				return true
+			}
+			delivered = true
+		case *OriginMessage:
+			if w.transaction.active() {
+				w.transaction.tx.Origin = v.Name
+			}
+		case *RelationMessage, *TypeMessage:
+			// kept in the relation cache only
+		default:
+			if !w.transaction.active() {
+				// changes outside a transaction, e.g. non-transactional
+				// logical decoding messages, are delivered on their own
+				tx := &Transaction{
+					Slot:            w.Slot,
+					consumedXLogPos: xLogPos,
+					database:        w.DBName,
+					systemID:        w.SystemID,
+				}
+				tx.append(m)
+				w.deliverTransaction(tx)
+				delivered = true
+				continue
+			}
+			if err := w.transaction.append(m, size); err != nil {
+				// the transaction misses changes and is never delivered
+				err = fmt.Errorf("buffer transaction %d: %w", w.transaction.tx.Xid, err)
+				w.transaction.discard()
+				w.processError(ErrorPhaseHandle, data.WALStart, err)
+				w.escalate(ErrorStopSlot, err)
+				return delivered
+			}
+			size = 0
+		}
+	}
+	return delivered
+}
+
+func (w *consumerPollingWorker) deliverTransaction(tx *Transaction) {
+	w.consumer.wg.Add(1)
+	defer w.consumer.wg.Done()
+	defer tx.release()
+
+	tx.Delegate = &clientTransactionDelegate{worker: w}
+	tx.ackEntry = w.tracker.track(tx.consumedXLogPos)
+
+	err := protect(func() { w.TransactionHandler(tx) })
+	if err != nil {
+		if w.processPoison(&DeadLetter{Slot: w.Slot, LSN: tx.CommitLSN, Transaction: tx, Err: err}) {
+			if tx.canAck() {
+				w.acknowledgeTransaction(tx)
+			}
+		}
+		return
+	}
+
+	if w.consumer.Config.AckMode == AutoAck {
+		if tx.canAck() {
+			w.acknowledgeTransaction(tx)
+		}
+	}
+}
+
+func (w *consumerPollingWorker) decodeMessage(msg *Message) {
+	if w.Decoder == nil {
+		return
+	}
 
-		w.MessageHandler(&msg)
+	msg.decodable = true
+	msg.decoded, msg.decodeErr = w.Decoder.Decode(w.relations, msg.Body())
+	if msg.decodeErr != nil {
+		msg.decodeErr = &DecodeError{Slot: w.Slot, LSN: msg.StartLSN(), Err: msg.decodeErr}
+		w.processError(ErrorPhaseParse, msg.StartLSN(), msg.decodeErr)
 	}
 }
 
 func (w *consumerPollingWorker) processEvent(event Event) {
-	if w.EventHandler != nil {
-		w.consumer.wg.Add(1)
-		defer w.consumer.wg.Done()
+	if w.EventHandler == nil {
+		return
+	}
+
+	var err error
+	w.consumer.wg.Add(1)
+	if perr := protect(func() { err = w.EventHandler(event) }); perr != nil {
+		err = perr
+	}
+	w.consumer.wg.Done()
 
-		w.EventHandler(event)
+	if err != nil {
+		w.processError(ErrorPhaseHandle, w.progress.Progress().Received, err)
 	}
 }
 
-func (w *consumerPollingWorker) processError(err error) (disposed bool) {
-	if w.EventHandler != nil {
+// processError passes err to the ErrorHandler, or logs it when there is
+// none, and records the decision for resolveFailure.
+func (w *consumerPollingWorker) processError(phase ErrorPhase, lsn LSN, err error) ErrorDecision {
+	var (
+		failure  = &ConsumerError{Slot: w.Slot, LSN: lsn, Phase: phase, Err: err}
+		decision = ErrorContinue
+	)
+	if w.ErrorHandler != nil {
 		w.consumer.wg.Add(1)
-		defer w.consumer.wg.Done()
+		if err := protect(func() { decision = w.ErrorHandler(failure) }); err != nil {
+			w.Logger.Printf("ErrorHandler failed on %+v: %+v", failure, err)
+			decision = ErrorStopConsumer
+		}
+		w.consumer.wg.Done()
+	} else {
+		w.Logger.Printf("%+v", failure)
+	}
+
+	w.escalate(decision, failure)
+	return decision
+}
 
-		return w.ErrorHandler(err)
+// processPoison applies the PoisonMessagePolicy to a message or
+// transaction whose handler panicked; it returns true when the caller
+// acknowledges it and goes on.
+func (w *consumerPollingWorker) processPoison(letter *DeadLetter) bool {
+	if w.processError(ErrorPhaseHandle, letter.LSN, letter.Err); w.failing() {
+		return false
+	}
+
+	switch w.consumer.Config.PoisonMessagePolicy {
+	case PoisonMessageSkip:
+		return true
+	case PoisonMessageDeadLetter:
+		var err error
+		if perr := protect(func() { err = w.DeadLetterHandler(letter) }); perr != nil {
+			err = perr
+		}
+		if err == nil {
+			return true
+		}
+		err = fmt.Errorf("dead-letter message at %s: %w", letter.LSN, err)
+		w.processError(ErrorPhaseHandle, letter.LSN, err)
+		w.escalate(ErrorStopSlot, err)
+		return false
 	}
+	w.escalate(ErrorStopSlot, letter.Err)
 	return false
 }
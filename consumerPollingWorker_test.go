@@ -0,0 +1,260 @@
+package postgres
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// newTestConsumer returns a Consumer whose workers can be built with
+// newConsumerPollingWorker without subscribing any slot.
+func newTestConsumer(config *Config) *Consumer {
+	if config == nil {
+		config = new(Config)
+	}
+	c := &Consumer{
+		Config: config,
+		Logger: log.New(io.Discard, "", 0),
+	}
+	c.init()
+	c.ctx, c.cancel = context.WithCancelCause(context.Background())
+	return c
+}
+
+func newXLogDataTestMessage(lsn LSN, data string) []byte {
+	var buf = make([]byte, 25, 25+len(data))
+	buf[0] = pglogrepl.XLogDataByteID
+	binary.BigEndian.PutUint64(buf[1:], uint64(lsn))
+	binary.BigEndian.PutUint64(buf[9:], uint64(lsn))
+	return append(buf, data...)
+}
+
+func newKeepaliveTestMessage(walEnd LSN) []byte {
+	var buf = make([]byte, 18)
+	buf[0] = pglogrepl.PrimaryKeepaliveMessageByteID
+	binary.BigEndian.PutUint64(buf[1:], uint64(walEnd))
+	return buf
+}
+
+func TestConsumer_SlotConnections(t *testing.T) {
+	replication := newStandInReplication(
+		ReplicationSlotSource{SlotName: "orders", Plugin: "test_decoding", SlotType: LogicalReplication, Database: "postgres", ConfirmedFlushLSN: LSN(0x1000)},
+		ReplicationSlotSource{SlotName: "payments", Plugin: "test_decoding", SlotType: LogicalReplication, Database: "postgres", ConfirmedFlushLSN: LSN(0x1000)},
+	)
+	server := newStandInReplicationServer(t, replication)
+
+	var received = make(chan *Message, 2)
+	consumer := &Consumer{
+		MessageHandler: func(msg *Message) { received <- msg },
+		Logger:         log.New(io.Discard, "", 0),
+		Config:         newStandInConfig(server),
+	}
+	err := consumer.Subscribe(SlotOffset{Slot: "orders"}, SlotOffset{Slot: "payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	var streams = make(map[string]*standInStream)
+	for i := 0; i < 2; i++ {
+		s := replication.Stream(t)
+		streams[s.Slot] = s
+	}
+	if len(streams) != 2 {
+		t.Fatalf("expected a stream per slot, got %v", streams)
+	}
+	if n := len(server.Startups()); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+
+	var (
+		orders   = streams["orders"]
+		payments = streams["payments"]
+	)
+	if err = orders.Send(newXLogDataTestMessage(LSN(0x2000), "order")); err != nil {
+		t.Fatal(err)
+	}
+	if err = payments.Send(newXLogDataTestMessage(LSN(0x5000), "payment")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			if want := map[string]string{"orders": "order", "payments": "payment"}[msg.Slot]; string(msg.Body()) != want {
+				t.Errorf("slot '%s' received '%s'", msg.Slot, msg.Body())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the messages")
+		}
+	}
+
+	orders.WaitFlushed(t, LSN(0x2000))
+	payments.WaitFlushed(t, LSN(0x5000))
+	for _, lsn := range orders.Flushed() {
+		if lsn > LSN(0x2000) {
+			t.Errorf("slot 'orders' confirmed %s of slot 'payments'", lsn)
+		}
+	}
+}
+
+func TestConsumerPollingWorker_AckNeverBlocks(t *testing.T) {
+	consumer := newTestConsumer(&Config{AckMode: ManualAck})
+	consumer.MessageHandler = func(msg *Message) {
+		// acknowledged synchronously on the worker goroutine
+		msg.Delegate.OnAck(msg)
+	}
+	worker := newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000))
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		// acks of other goroutines pile up while the worker is busy
+		for i := 1; i <= 1000; i++ {
+			worker.ack(LSN(0x1000 + i))
+		}
+		worker.processData(newXLogDataTestMessage(LSN(0x3000), "row"))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the worker blocked on its own ack")
+	}
+
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x3000) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x3000), p.Flushed)
+	}
+}
+
+func TestConsumer_Reconnect(t *testing.T) {
+	replication := newStandInReplication(ReplicationSlotSource{
+		SlotName:          "orders",
+		Plugin:            "test_decoding",
+		SlotType:          LogicalReplication,
+		Database:          "postgres",
+		ConfirmedFlushLSN: LSN(0x1000),
+	})
+	server := newStandInReplicationServer(t, replication)
+
+	var (
+		config = newStandInConfig(server)
+		events = make(chan Event, 16)
+	)
+	config.ReconnectBackoff = 10 * time.Millisecond
+	consumer := &Consumer{
+		MessageHandler: func(msg *Message) {},
+		EventHandler: func(event Event) error {
+			switch event.(type) {
+			case *ReconnectingEvent, *ReconnectedEvent:
+				events <- event
+			}
+			return nil
+		},
+		Logger: log.New(io.Discard, "", 0),
+		Config: config,
+	}
+	if err := consumer.Subscribe(SlotOffset{Slot: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	stream := replication.Stream(t)
+	if stream.StartLSN != LSN(0x1000) {
+		t.Errorf("expected to start at %s, got %s", LSN(0x1000), stream.StartLSN)
+	}
+	if err := stream.Send(newXLogDataTestMessage(LSN(0x2000), "order")); err != nil {
+		t.Fatal(err)
+	}
+	stream.WaitFlushed(t, LSN(0x2000))
+
+	if err := stream.Fail("terminating connection due to administrator command"); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := replication.Stream(t)
+	if resumed.StartLSN != LSN(0x2000) {
+		t.Errorf("expected to resume at %s, got %s", LSN(0x2000), resumed.StartLSN)
+	}
+
+	for _, want := range []Event{
+		&ReconnectingEvent{Slot: "orders", Attempt: 1, Delay: 10 * time.Millisecond},
+		&ReconnectedEvent{Slot: "orders", Attempt: 1, StartLSN: LSN(0x2000)},
+	} {
+		select {
+		case event := <-events:
+			if e, ok := event.(*ReconnectingEvent); ok {
+				var walErr *WALError
+				if !errors.As(e.Err, &walErr) {
+					t.Errorf("expected a WALError, got %v", e.Err)
+				}
+				e.Err = nil
+			}
+			if !reflect.DeepEqual(event, want) {
+				t.Errorf("expected %+v, got %+v", want, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %T", want)
+		}
+	}
+}
+
+func TestConsumer_ReconnectMaxAttempts(t *testing.T) {
+	replication := newStandInReplication(ReplicationSlotSource{
+		SlotName:          "orders",
+		Plugin:            "test_decoding",
+		SlotType:          LogicalReplication,
+		Database:          "postgres",
+		ConfirmedFlushLSN: LSN(0x1000),
+	})
+	server := newStandInReplicationServer(t, replication)
+
+	var (
+		config = newStandInConfig(server)
+		delays []time.Duration
+	)
+	config.ReconnectBackoff = 10 * time.Millisecond
+	config.ReconnectMaxBackoff = 25 * time.Millisecond
+	config.ReconnectMaxAttempts = 3
+	consumer := &Consumer{
+		MessageHandler: func(msg *Message) {},
+		EventHandler: func(event Event) error {
+			if e, ok := event.(*ReconnectingEvent); ok {
+				delays = append(delays, e.Delay)
+			}
+			return nil
+		},
+		Logger: log.New(io.Discard, "", 0),
+		Config: config,
+	}
+	if err := consumer.Subscribe(SlotOffset{Slot: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	stream := replication.Stream(t)
+	// every reconnect attempt is refused
+	server.listener.Close()
+	if err := stream.Fail("terminating connection due to administrator command"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-consumer.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the Consumer to stop")
+	}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("expected delays %v, got %v", expected, delays)
+	}
+	var walErr *WALError
+	if err := consumer.Err(); !errors.As(err, &walErr) {
+		t.Errorf("expected the WALError as the cause, got %v", err)
+	}
+}
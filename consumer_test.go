@@ -2,6 +2,7 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -28,7 +29,8 @@ func TestConsumer(t *testing.T) {
 		},
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 13*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 13*time.Second)
+	defer cancel()
 
 	err := consumer.Subscribe(
 		postgres.SlotOffset{Slot: "golang_replication_slot_temp"},
@@ -47,3 +49,83 @@ func TestConsumer(t *testing.T) {
 	<-ctx.Done()
 	consumer.Close()
 }
+
+func TestConsumer_Run(t *testing.T) {
+	consumer := &postgres.Consumer{
+		Config: &postgres.Config{
+			PollingTimeout: time.Millisecond * 100,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := consumer.Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	select {
+	case <-consumer.Done():
+	default:
+		t.Fatal("expected the Consumer to be stopped")
+	}
+
+	err = consumer.Subscribe()
+	if !errors.Is(err, postgres.ErrConsumerDisposed) {
+		t.Fatalf("expected ErrConsumerDisposed, got %v", err)
+	}
+}
+
+func TestConsumer_Close(t *testing.T) {
+	consumer := &postgres.Consumer{
+		Config: &postgres.Config{
+			PollingTimeout: time.Millisecond * 100,
+		},
+	}
+
+	err := consumer.SubscribeContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = consumer.Subscribe()
+	if !errors.Is(err, postgres.ErrConsumerRunning) {
+		t.Fatalf("expected ErrConsumerRunning, got %v", err)
+	}
+
+	consumer.Close()
+	<-consumer.Done()
+	if err = consumer.Err(); !errors.Is(err, postgres.ErrConsumerClosed) {
+		t.Fatalf("expected ErrConsumerClosed, got %v", err)
+	}
+}
+
+func TestConsumer_SubscribeContextCanceled(t *testing.T) {
+	consumer := &postgres.Consumer{
+		Config: &postgres.Config{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := consumer.SubscribeContext(ctx, postgres.Slot("foo"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	consumer.Close()
+}
+
+func TestConsumer_InitialSnapshotRequiresMessageHandler(t *testing.T) {
+	consumer := &postgres.Consumer{
+		Config: &postgres.Config{},
+	}
+
+	err := consumer.Subscribe(postgres.InitialSnapshot{
+		Slot:   "foo",
+		Plugin: postgres.PgOutputPlugin,
+		Tables: []string{"public.orders"},
+	})
+	if err == nil {
+		t.Fatal("expected error without a MessageHandler")
+	}
+	consumer.Close()
+}
@@ -0,0 +1,24 @@
+package postgres
+
+// PublicationTable is a table of a publication. Columns and Where
+// restrict the published columns and rows and require PostgreSQL 15.
+type PublicationTable struct {
+	Name    string   `json:"Name"`
+	Columns []string `json:"Columns,omitempty"`
+	Where   string   `json:"Where,omitempty"`
+}
+
+type CreatePublicationSource struct {
+	PublicationName string             `json:"PublicationName"`
+	AllTables       bool               `json:"AllTables"`
+	Tables          []PublicationTable `json:"Tables"`
+	// Publish lists the operations to publish: insert, update, delete
+	// and truncate. Empty publishes all of them.
+	Publish []string `json:"Publish"`
+}
+
+func (s *CreatePublicationSource) AsProvider() CreatePublicationSourceProvider {
+	var p CreatePublicationSourceProvider
+	p.AppendSource(*s)
+	return p
+}
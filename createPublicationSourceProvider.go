@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"encoding/json"
+	"os"
+)
+
+type CreatePublicationSourceProvider struct {
+	sources []CreatePublicationSource
+}
+
+func (p *CreatePublicationSourceProvider) Append(provider *CreatePublicationSourceProvider) error {
+	p.sources = append(p.sources, provider.sources...)
+	return nil
+}
+
+func (p *CreatePublicationSourceProvider) AppendSource(source CreatePublicationSource) error {
+	p.sources = append(p.sources, source)
+	return nil
+}
+
+func (p *CreatePublicationSourceProvider) Scan(buf []byte) error {
+	var source []CreatePublicationSource
+	err := json.Unmarshal(buf, &source)
+	if err != nil {
+		return err
+	}
+	p.sources = append(p.sources, source...)
+	return nil
+}
+
+func (p *CreatePublicationSourceProvider) ScanString(text string) error {
+	return p.Scan([]byte(text))
+}
+
+func (p *CreatePublicationSourceProvider) ScanFile(filepath string) error {
+	buf, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	return p.Scan(buf)
+}
+
+func (p *CreatePublicationSourceProvider) Sources() []CreatePublicationSource {
+	return p.sources
+}
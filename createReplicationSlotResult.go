@@ -0,0 +1,12 @@
+package postgres
+
+// CreateReplicationSlotResult is what the server returns for a created
+// slot. SnapshotName is set when the slot was created with
+// ExportSnapshot; it can be passed to SET TRANSACTION SNAPSHOT on
+// another connection while the creating connection stays idle.
+type CreateReplicationSlotResult struct {
+	SlotName        string
+	ConsistentPoint LSN
+	SnapshotName    string
+	OutputPlugin    string
+}
@@ -2,26 +2,31 @@ package postgres
 
 import (
 	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
 )
 
 var (
 	_ json.Unmarshaler = new(CreateReplicationSlotSource)
+	_ yaml.Unmarshaler = new(CreateReplicationSlotSource)
 )
 
 type CreateReplicationSlotSource struct {
-	SlotName       string          `json:"SlotName"`
-	Plugin         string          `json:"Plugin"`
-	Temporary      bool            `json:"Temporary"`
-	SlotType       ReplicationMode `json:"SlotType"`
-	SnapshotAction string          `json:"SnapshotAction"`
+	SlotName       string          `json:"SlotName" yaml:"SlotName"`
+	Plugin         string          `json:"Plugin" yaml:"Plugin"`
+	Temporary      bool            `json:"Temporary" yaml:"Temporary"`
+	SlotType       ReplicationMode `json:"SlotType" yaml:"SlotType"`
+	SnapshotAction string          `json:"SnapshotAction" yaml:"SnapshotAction"`
 }
 
-// UnmarshalJSON implements json.Unmarshaler.
+// UnmarshalJSON implements json.Unmarshaler. A missing SlotType means
+// LogicalReplication, as in UnmarshalYAML.
 func (s *CreateReplicationSlotSource) UnmarshalJSON(data []byte) error {
 	type Alias CreateReplicationSlotSource
 	dummy := &struct {
 		*Alias
-		SlotType string `yaml:"SlotType"`
+		SlotType *string `json:"SlotType"`
 	}{
 		Alias: (*Alias)(s),
 	}
@@ -30,12 +35,52 @@ func (s *CreateReplicationSlotSource) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	t, err := ParseReplicationMode(dummy.SlotType)
-	if err != nil {
-		return err
+	s.SlotType = LogicalReplication
+	if dummy.SlotType != nil {
+		t, err := ParseReplicationMode(*dummy.SlotType)
+		if err != nil {
+			return err
+		}
+		s.SlotType = t
+	}
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler. Values may reference
+// environment variables as $NAME, ${NAME} or ${NAME:-default}; "$$" is a
+// literal "$". Errors are *SourceFieldError.
+func (s *CreateReplicationSlotSource) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return &SourceFieldError{Line: value.Line, Err: fmt.Errorf("expected a mapping")}
 	}
-	s.SlotType = t
 
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, node := value.Content[i], value.Content[i+1]
+
+		err := expandYAMLEnv(node)
+		if err == nil {
+			switch key.Value {
+			case "SlotName":
+				err = node.Decode(&s.SlotName)
+			case "Plugin":
+				err = node.Decode(&s.Plugin)
+			case "Temporary":
+				err = node.Decode(&s.Temporary)
+			case "SlotType":
+				var text string
+				if err = node.Decode(&text); err == nil {
+					s.SlotType, err = ParseReplicationMode(text)
+				}
+			case "SnapshotAction":
+				err = node.Decode(&s.SnapshotAction)
+			default:
+				err = fmt.Errorf("unknown field")
+			}
+		}
+		if err != nil {
+			return &SourceFieldError{Field: key.Value, Line: node.Line, Err: err}
+		}
+	}
 	return nil
 }
 
@@ -44,3 +89,31 @@ func (s *CreateReplicationSlotSource) AsProvider() CreateReplicationSlotSourcePr
 	p.AppendSource(*s)
 	return p
 }
+
+// validate checks the settings CREATE_REPLICATION_SLOT would reject. The
+// error is a *SourceFieldError naming the field.
+func (s *CreateReplicationSlotSource) validate() error {
+	if len(s.SlotName) == 0 {
+		return &SourceFieldError{Field: "SlotName", Err: fmt.Errorf("is required")}
+	}
+
+	switch s.SlotType {
+	case LogicalReplication:
+		if len(s.Plugin) == 0 {
+			return &SourceFieldError{Field: "Plugin", Err: fmt.Errorf("is required by a logical slot")}
+		}
+	case PhysicalReplication:
+		if len(s.Plugin) > 0 {
+			return &SourceFieldError{Field: "Plugin", Err: fmt.Errorf("is not supported by a physical slot")}
+		}
+	}
+
+	action, err := parseSnapshotAction(s.SnapshotAction)
+	if err != nil {
+		return &SourceFieldError{Field: "SnapshotAction", Err: err}
+	}
+	if s.SlotType == PhysicalReplication && len(action) > 0 {
+		return &SourceFieldError{Field: "SnapshotAction", Err: fmt.Errorf("is not supported by a physical slot")}
+	}
+	return nil
+}
@@ -2,7 +2,12 @@ package postgres
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 type CreateReplicationSlotSourceProvider struct {
@@ -33,12 +38,70 @@ func (p *CreateReplicationSlotSourceProvider) ScanString(text string) error {
 	return p.Scan([]byte(text))
 }
 
-func (p *CreateReplicationSlotSourceProvider) ScanFile(filepath string) error {
-	buf, err := os.ReadFile(filepath)
+// ScanYAML reads a YAML sequence of CreateReplicationSlotSource and
+// validates every entry; see CreateReplicationSlotSource.UnmarshalYAML
+// for the environment variables in values. An invalid entry is reported
+// as a *SourceFieldError and no entry of buf is appended.
+func (p *CreateReplicationSlotSourceProvider) ScanYAML(buf []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	var root = doc.Content[0]
+	if root.Kind != yaml.SequenceNode {
+		return fmt.Errorf("expected a sequence of replication slots at line %d", root.Line)
+	}
+
+	var (
+		sources = make([]CreateReplicationSlotSource, 0, len(root.Content))
+		names   = make(map[string]bool, len(root.Content))
+	)
+	for i, node := range root.Content {
+		var source CreateReplicationSlotSource
+
+		err := node.Decode(&source)
+		if err == nil {
+			err = source.validate()
+		}
+		if err == nil && names[source.SlotName] {
+			err = &SourceFieldError{Field: "SlotName", Err: fmt.Errorf("duplicate slot '%s'", source.SlotName)}
+		}
+		if err != nil {
+			fieldErr, ok := err.(*SourceFieldError)
+			if !ok {
+				fieldErr = &SourceFieldError{Err: err}
+			}
+			fieldErr.Entry = i
+			fieldErr.Name = source.SlotName
+			if fieldErr.Line == 0 {
+				fieldErr.Line = node.Line
+			}
+			return fieldErr
+		}
+
+		names[source.SlotName] = true
+		sources = append(sources, source)
+	}
+	p.sources = append(p.sources, sources...)
+	return nil
+}
+
+// ScanFile reads a YAML file when its extension is .yaml or .yml, and a
+// JSON file otherwise.
+func (p *CreateReplicationSlotSourceProvider) ScanFile(path string) error {
+	buf, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
 
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return p.ScanYAML(buf)
+	}
 	return p.Scan(buf)
 }
 
@@ -1,6 +1,9 @@
 package postgres_test
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	postgres "github.com/Bofry/lib-postgres-stream"
@@ -18,3 +21,155 @@ func TestCreateReplicationSlotSourceProvider(t *testing.T) {
 
 	t.Log(p.Sources())
 }
+
+func TestCreateReplicationSlotSourceProvider_ScanYAML(t *testing.T) {
+	t.Setenv("STREAM_SLOT_PREFIX", "orders")
+	t.Setenv("STREAM_TEMPORARY", "true")
+
+	var p postgres.CreateReplicationSlotSourceProvider
+	err := p.ScanYAML([]byte(`
+- SlotName: ${STREAM_SLOT_PREFIX}_main
+  Plugin: ${STREAM_PLUGIN:-pgoutput}
+  SlotType: logical
+  Temporary: ${STREAM_TEMPORARY}
+  SnapshotAction: export_snapshot
+- SlotName: "replica$$1"
+  SlotType: physical
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := p.Sources()
+	if len(sources) != 2 {
+		t.Fatalf("expected 2 sources, got %+v", sources)
+	}
+	expected := postgres.CreateReplicationSlotSource{
+		SlotName:       "orders_main",
+		Plugin:         postgres.PgOutputPlugin,
+		Temporary:      true,
+		SlotType:       postgres.LogicalReplication,
+		SnapshotAction: "export_snapshot",
+	}
+	if sources[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, sources[0])
+	}
+	if s := sources[1]; s.SlotName != "replica$1" || s.SlotType != postgres.PhysicalReplication {
+		t.Errorf("unexpected source %+v", s)
+	}
+}
+
+func TestCreateReplicationSlotSourceProvider_ScanYAML_Invalid(t *testing.T) {
+	cases := []struct {
+		text  string
+		entry int
+		name  string
+		field string
+		line  int
+	}{
+		{
+			text: `
+- SlotName: foo
+  Plugin: wal2json
+- SlotName: bar
+  SlotType: logic
+`,
+			entry: 1, name: "bar", field: "SlotType", line: 5,
+		},
+		{
+			text: `
+- SlotName: foo
+  SlotType: logical
+`,
+			entry: 0, name: "foo", field: "Plugin", line: 2,
+		},
+		{
+			text: `
+- SlotName: foo
+  Plugin: wal2json
+  Plugn: pgoutput
+`,
+			entry: 0, name: "foo", field: "Plugn", line: 4,
+		},
+		{
+			text: `
+- SlotName: foo
+  Plugin: ${STREAM_UNSET_PLUGIN}
+`,
+			entry: 0, name: "foo", field: "Plugin", line: 3,
+		},
+		{
+			text: `
+- SlotName: foo
+  Plugin: wal2json
+- SlotName: foo
+  Plugin: wal2json
+`,
+			entry: 1, name: "foo", field: "SlotName", line: 4,
+		},
+	}
+
+	for _, c := range cases {
+		var p postgres.CreateReplicationSlotSourceProvider
+		err := p.ScanYAML([]byte(c.text))
+
+		var fieldErr *postgres.SourceFieldError
+		if !errors.As(err, &fieldErr) {
+			t.Errorf("expected a SourceFieldError for %q, got %v", c.text, err)
+			continue
+		}
+		if fieldErr.Entry != c.entry || fieldErr.Name != c.name || fieldErr.Field != c.field || fieldErr.Line != c.line {
+			t.Errorf("unexpected error %+v: %v", fieldErr, fieldErr)
+		}
+		if len(p.Sources()) != 0 {
+			t.Errorf("expected no sources, got %+v", p.Sources())
+		}
+	}
+}
+
+func TestCreateReplicationSlotSourceProvider_MissingSlotType(t *testing.T) {
+	var yml, json postgres.CreateReplicationSlotSourceProvider
+	if err := yml.ScanYAML([]byte("- SlotName: foo\n  Plugin: wal2json\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Scan([]byte(`[{"SlotName": "foo", "Plugin": "wal2json"}]`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []postgres.CreateReplicationSlotSourceProvider{yml, json} {
+		if s := p.Sources(); len(s) != 1 || s[0].SlotType != postgres.LogicalReplication {
+			t.Errorf("expected a logical slot, got %+v", s)
+		}
+	}
+
+	if err := json.Scan([]byte(`[{"SlotName": "bar", "Plugin": "wal2json", "SlotType": ""}]`)); err == nil {
+		t.Error("expected error for an empty SlotType")
+	}
+}
+
+func TestCreateReplicationSlotSourceProvider_ScanFile(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		yml  = filepath.Join(dir, "slots.yml")
+		json = filepath.Join(dir, "slots.json")
+	)
+	if err := os.WriteFile(yml, []byte("- SlotName: foo\n  Plugin: wal2json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(json, []byte(`[{"SlotName": "bar", "Plugin": "wal2json", "SlotType": "logical"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var p postgres.CreateReplicationSlotSourceProvider
+	if err := p.ScanFile(yml); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ScanFile(json); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := p.Sources()
+	if len(sources) != 2 || sources[0].SlotName != "foo" || sources[1].SlotName != "bar" {
+		t.Errorf("unexpected sources %+v", sources)
+	}
+}
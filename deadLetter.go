@@ -0,0 +1,13 @@
+package postgres
+
+// DeadLetter is a message or transaction whose handler panicked, passed
+// to the Consumer.DeadLetterHandler under PoisonMessageDeadLetter.
+// Exactly one of Message and Transaction is set; both are valid only
+// during the call.
+type DeadLetter struct {
+	Slot        string
+	LSN         LSN
+	Message     *Message
+	Transaction *Transaction
+	Err         error // the *PanicError
+}
@@ -0,0 +1,19 @@
+package postgres
+
+import "fmt"
+
+// DecodeError reports WAL data of Slot at LSN that could not be parsed
+// or decoded by the MessageDecoder.
+type DecodeError struct {
+	Slot string
+	LSN  LSN
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode failed on (%s#%s): %v", e.Slot, e.LSN, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
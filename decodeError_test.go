@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+)
+
+type failingDecoder struct{ err error }
+
+func (d failingDecoder) Decode(relations *RelationCache, data []byte) ([]LogicalMessage, error) {
+	return nil, d.err
+}
+
+func TestDecodeError(t *testing.T) {
+	var (
+		cause    = errors.New("unexpected message")
+		consumer = newTestConsumer(nil)
+		msg      = &Message{
+			Slot: "orders",
+			data: &pglogrepl.XLogData{WALStart: LSN(0x2000), WALData: []byte("?")},
+		}
+	)
+	consumer.Decoder = failingDecoder{err: cause}
+	worker := newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000))
+	worker.decodeMessage(msg)
+
+	_, err := msg.Decode()
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected a DecodeError, got %v", err)
+	}
+	if decodeErr.Slot != "orders" || decodeErr.LSN != LSN(0x2000) || !errors.Is(err, cause) {
+		t.Errorf("unexpected error %+v", decodeErr)
+	}
+}
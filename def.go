@@ -1,8 +1,10 @@
 package postgres
 
 import (
+	"errors"
 	"log"
 	"os"
+	"time"
 
 	"github.com/jackc/pglogrepl"
 )
@@ -18,40 +20,191 @@ SELECT slot_name,
 			 temporary,
 			 active,
 			 restart_lsn,
-			 confirmed_flush_lsn
+			 confirmed_flush_lsn%s
   FROM "pg_catalog"."pg_replication_slots"
 WHERE slot_name IN (%s);`
 
+	__SQL_LIST_REPLICATION_SLOTS string = `
+SELECT slot_name,
+       plugin,
+       slot_type,
+       database,
+       temporary,
+       active,
+       restart_lsn,
+       confirmed_flush_lsn%s
+  FROM "pg_catalog"."pg_replication_slots"
+ORDER BY slot_name;`
+
+	// wal_status of PostgreSQL 13
+	__SQL_REPLICATION_SLOT_WAL_STATUS string = `,
+       wal_status`
+
+	// wal_status and safe_wal_size of PostgreSQL 13
+	__SQL_MONITOR_REPLICATION_SLOTS string = `
+SELECT slot_name,
+       slot_type,
+       active,
+       %s,
+       restart_lsn,
+       confirmed_flush_lsn,
+       CASE WHEN "pg_catalog"."pg_is_in_recovery"()
+            THEN "pg_catalog"."pg_last_wal_replay_lsn"()
+            ELSE "pg_catalog"."pg_current_wal_lsn"()
+       END
+  FROM "pg_catalog"."pg_replication_slots"
+ORDER BY slot_name;`
+
+	__SQL_ADVANCE_REPLICATION_SLOT string = `
+SELECT end_lsn
+  FROM "pg_catalog"."pg_replication_slot_advance"(%s, %s);`
+
+	__SQL_SELECT_RELATION string = `
+SELECT c.oid,
+       n.nspname,
+       c.relname
+  FROM "pg_catalog"."pg_class" c
+  JOIN "pg_catalog"."pg_namespace" n ON n.oid = c.relnamespace
+WHERE c.oid = %s::regclass;`
+
+	__SQL_SELECT_PRIMARY_KEY string = `
+SELECT a.attname
+  FROM "pg_catalog"."pg_index" i
+  JOIN "pg_catalog"."pg_attribute" a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+WHERE i.indrelid = %d
+  AND i.indisprimary
+ORDER BY array_position(i.indkey, a.attnum);`
+
+	__SNAPSHOT_CURSOR_NAME = "__lib_postgres_stream_snapshot"
+
+	__SQL_EMIT_SNAPSHOT_WATERMARK string = `SELECT pg_logical_emit_message(false, %s, %s);`
+
+	__SNAPSHOT_LOW_WATERMARK  = "low:"
+	__SNAPSHOT_HIGH_WATERMARK = "high:"
+
+	__SNAPSHOT_SLOT_SUFFIX = "_snapshot_load"
+
+	__SQL_COPY_REPLICATION_SLOT string = `
+SELECT slot_name
+  FROM "pg_catalog"."pg_copy_logical_replication_slot"(%s, %s, false);`
+
+	__SQL_SELECT_PUBLICATIONS string = `
+SELECT pubname,
+       puballtables,
+       pubinsert,
+       pubupdate,
+       pubdelete,
+       pubtruncate
+  FROM "pg_catalog"."pg_publication"
+ORDER BY pubname;`
+
+	__SQL_SELECT_PUBLICATION_TABLES string = `
+SELECT p.pubname,
+       n.nspname,
+       c.relname,
+       %s
+  FROM "pg_catalog"."pg_publication_rel" r
+  JOIN "pg_catalog"."pg_publication" p ON p.oid = r.prpubid
+  JOIN "pg_catalog"."pg_class" c ON c.oid = r.prrelid
+  JOIN "pg_catalog"."pg_namespace" n ON n.oid = c.relnamespace
+ORDER BY p.pubname, n.nspname, c.relname;`
+
+	// FOR TABLES IN SCHEMA of PostgreSQL 15
+	__SQL_SELECT_PUBLICATION_SCHEMAS string = `
+SELECT p.pubname,
+       n.nspname
+  FROM "pg_catalog"."pg_publication_namespace" pn
+  JOIN "pg_catalog"."pg_publication" p ON p.oid = pn.pnpubid
+  JOIN "pg_catalog"."pg_namespace" n ON n.oid = pn.pnnspid
+ORDER BY p.pubname, n.nspname;`
+
+	// column lists and row filters of PostgreSQL 15
+	__SQL_PUBLICATION_TABLE_FILTERS string = `(SELECT array_agg(a.attname ORDER BY a.attnum)
+          FROM "pg_catalog"."pg_attribute" a
+         WHERE a.attrelid = r.prrelid AND a.attnum = ANY(r.prattrs)),
+       "pg_catalog"."pg_get_expr"(r.prqual, r.prrelid)`
+
 	__PG_ERRCODE_DUPLICATE_OBJECT = "42710"
 
+	DefaultTransactionMaxMemory = 64 << 20
+	DefaultSnapshotBatchSize    = 1000
+
+	// SnapshotWatermarkPrefix is the prefix of the logical decoding
+	// messages an IncrementalSnapshot writes to the WAL. Consumers with a
+	// Decoder never deliver them.
+	SnapshotWatermarkPrefix = "lib-postgres-stream.snapshot"
+
+	DefaultSlotMonitorInterval = 30 * time.Second
+	DefaultSlotLagThreshold    = 1 << 30
+
+	DefaultReconnectBackoff    = 1 * time.Second
+	DefaultReconnectMaxBackoff = 30 * time.Second
+
 	StreamZeroOffset           string = "0"
 	StreamNeverDeliveredOffset string = ">"
 	StreamUnspecifiedOffset    string = ""
 )
 
+const (
+	ReconnectingEventByteID byte = 0x01 + iota
+	ReconnectedEventByteID
+	ClusterChangedEventByteID
+	SnapshotCompletedEventByteID
+	SlotLagWarningEventByteID
+	SlotInvalidatedEventByteID
+)
+
 const (
 	LogicalReplication  = pglogrepl.LogicalReplication
 	PhysicalReplication = pglogrepl.PhysicalReplication
 
-	Wal2JsonPlugin = "wal2json"
+	ExportSnapshot   = "EXPORT_SNAPSHOT"
+	NoExportSnapshot = "NOEXPORT_SNAPSHOT"
+	UseSnapshot      = "USE_SNAPSHOT"
+
+	PgOutputPlugin     = "pgoutput"
+	Wal2JsonPlugin     = "wal2json"
+	TestDecodingPlugin = "test_decoding"
 )
 
 var (
+	ErrConsumerDisposed = errors.New("the Consumer has been disposed")
+	ErrConsumerRunning  = errors.New("the Consumer is running")
+	ErrConsumerClosed   = errors.New("the Consumer has been closed")
+
+	ErrSlotNotFound         = errors.New("replication slot does not exist")
+	ErrSlotDatabaseMismatch = errors.New("replication slot belongs to another database")
+	ErrSlotTypeMismatch     = errors.New("replication slot type does not match the replication mode")
+	ErrSlotActive           = errors.New("replication slot is active")
+	ErrSlotInvalidated      = errors.New("replication slot has been invalidated")
+
 	defaultLogger *log.Logger = log.New(os.Stdout, LOGGER_PREFIX, log.LstdFlags|log.Lmsgprefix)
+
+	timestamptzLayouts = []string{
+		"2006-01-02 15:04:05.999999999-07",
+		"2006-01-02 15:04:05.999999999-07:00",
+		time.RFC3339Nano,
+	}
 )
 
 type (
 	LSN             = pglogrepl.LSN
 	ReplicationMode = pglogrepl.ReplicationMode
 
-	MessageHandleProc func(message *Message)
-	EventHandleProc   func(event Event) error
-	ErrorHandleProc   func(err error) (disposed bool)
+	MessageHandleProc     func(message *Message)
+	TransactionHandleProc func(tx *Transaction)
+	EventHandleProc       func(event Event) error
+	ErrorHandleProc       func(err *ConsumerError) ErrorDecision
+	DeadLetterHandleProc  func(letter *DeadLetter) error
 
 	MessageDelegate interface {
 		OnAck(msg *Message)
 	}
 
+	TransactionDelegate interface {
+		OnAck(tx *Transaction)
+	}
+
 	Event interface {
 		ByteID() byte
 	}
@@ -63,4 +216,12 @@ type (
 	ReplicationOption interface {
 		applyStartReplicationOptions(opt *pglogrepl.StartReplicationOptions)
 	}
+
+	MessageDecoder interface {
+		Decode(relations *RelationCache, data []byte) ([]LogicalMessage, error)
+	}
+
+	LogicalMessage interface {
+		Type() MessageType
+	}
 )
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// IncrementalSnapshot re-reads a table through a slot that keeps
+// streaming. The table is read in primary key order, ChunkSize rows at a
+// time, and every chunk is bracketed by a low and a high watermark
+// written to the WAL with pg_logical_emit_message. Rows of a chunk that
+// change between its watermarks are dropped from the chunk, because the
+// streamed change already carries the newer row; the remaining rows are
+// delivered to the MessageHandler as ReadMessage rows when the high
+// watermark is streamed.
+//
+// The slot must decode logical decoding messages: pgoutput requires the
+// "messages" plugin argument, and wal2json must not filter the
+// SnapshotWatermarkPrefix.
+type IncrementalSnapshot struct {
+	Slot  string
+	Table string
+	// ChunkSize is the number of rows read between two watermarks; zero
+	// means DefaultSnapshotBatchSize.
+	ChunkSize int
+}
+
+func (s *IncrementalSnapshot) chunkSize() int {
+	if s.ChunkSize <= 0 {
+		return DefaultSnapshotBatchSize
+	}
+	return s.ChunkSize
+}
+
+// snapshotWindow is the chunk of an IncrementalSnapshot between its low
+// and high watermark.
+type snapshotWindow struct {
+	id       string
+	relation *RelationMessage
+	keys     []string
+	done     chan struct{}
+
+	mutex sync.Mutex
+	rows  []*ReadMessage
+
+	// owned by the worker
+	open      bool
+	changed   map[string]bool
+	truncated bool
+}
+
+func newSnapshotWindow(relation *RelationMessage) (*snapshotWindow, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	return &snapshotWindow{
+		id:       hex.EncodeToString(id[:]),
+		relation: relation,
+		keys:     relation.KeyColumns(),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func (w *snapshotWindow) lowWatermark() string {
+	return __SNAPSHOT_LOW_WATERMARK + w.id
+}
+
+func (w *snapshotWindow) highWatermark() string {
+	return __SNAPSHOT_HIGH_WATERMARK + w.id
+}
+
+func (w *snapshotWindow) setRows(rows []*ReadMessage) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.rows = rows
+}
+
+// begin opens the window when the low watermark is streamed.
+func (w *snapshotWindow) begin() {
+	w.open = true
+	w.changed = make(map[string]bool)
+	w.truncated = false
+}
+
+// observe records the keys of the streamed change when it touches the
+// window's table.
+func (w *snapshotWindow) observe(msg LogicalMessage) {
+	if !w.open {
+		return
+	}
+
+	switch v := msg.(type) {
+	case *InsertMessage:
+		if w.matches(v.Relation) {
+			w.change(v.New)
+		}
+	case *UpdateMessage:
+		if w.matches(v.Relation) {
+			w.change(v.Old)
+			w.change(v.New)
+		}
+	case *DeleteMessage:
+		if w.matches(v.Relation) {
+			w.change(v.Old)
+		}
+	case *TruncateMessage:
+		for _, r := range v.Relations {
+			if w.matches(r) {
+				w.truncated = true
+			}
+		}
+	}
+}
+
+// end closes the window when the high watermark is streamed and returns
+// the rows of the chunk that did not change inside it.
+func (w *snapshotWindow) end() []*ReadMessage {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.truncated {
+		return nil
+	}
+
+	var rows = make([]*ReadMessage, 0, len(w.rows))
+	for _, r := range w.rows {
+		if key, ok := w.key(r.New); ok && w.changed[key] {
+			continue
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func (w *snapshotWindow) matches(relation *RelationMessage) bool {
+	return relation != nil &&
+		relation.Namespace == w.relation.Namespace &&
+		relation.RelationName == w.relation.RelationName
+}
+
+func (w *snapshotWindow) change(tuple Tuple) {
+	if key, ok := w.key(tuple); ok {
+		w.changed[key] = true
+	}
+}
+
+// key joins the text of the primary key columns of tuple; ok is false
+// when the tuple lacks any of them.
+func (w *snapshotWindow) key(tuple Tuple) (string, bool) {
+	var sb strings.Builder
+	for i, name := range w.keys {
+		col, ok := tuple.Get(name)
+		if !ok || col.IsUnchangedToast() {
+			return "", false
+		}
+		if i > 0 {
+			sb.WriteByte(0)
+		}
+		sb.Write(col.Data)
+	}
+	return sb.String(), len(w.keys) > 0
+}
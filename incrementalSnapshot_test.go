@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+)
+
+func newSnapshotTestRelation() *RelationMessage {
+	return &RelationMessage{
+		Namespace:    "public",
+		RelationName: "orders",
+		Columns: []RelationColumn{
+			{Name: "id", Key: true},
+			{Name: "name"},
+		},
+	}
+}
+
+func newSnapshotTestTuple(id, name string) Tuple {
+	return Tuple{
+		{Name: "id", Kind: TupleDataTypeText, Data: []byte(id)},
+		{Name: "name", Kind: TupleDataTypeText, Data: []byte(name)},
+	}
+}
+
+func TestConsumerPollingWorker_ObserveSnapshot(t *testing.T) {
+	var (
+		relation = newSnapshotTestRelation()
+		other    = &RelationMessage{Namespace: "public", RelationName: "customers"}
+		received []*Message
+		consumer = newTestConsumer(nil)
+	)
+	consumer.MessageHandler = func(msg *Message) {
+		received = append(received, msg)
+	}
+	worker := newConsumerPollingWorker(consumer, "foo", nil, LSN(0))
+
+	window, err := newSnapshotWindow(relation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	window.setRows([]*ReadMessage{
+		{Relation: relation, New: newSnapshotTestTuple("1", "a")},
+		{Relation: relation, New: newSnapshotTestTuple("2", "b")},
+		{Relation: relation, New: newSnapshotTestTuple("3", "c")},
+		{Relation: relation, New: newSnapshotTestTuple("4", "d")},
+	})
+	worker.setSnapshotWindow(window)
+
+	watermark := func(content string) LogicalMessage {
+		return &LogicalDecodingMessage{Prefix: SnapshotWatermarkPrefix, Content: []byte(content)}
+	}
+
+	// changes before the low watermark do not touch the chunk
+	worker.observeSnapshot(LSN(1), []LogicalMessage{
+		&UpdateMessage{Relation: relation, New: newSnapshotTestTuple("1", "x")},
+	})
+	if n := worker.observeSnapshot(LSN(2), []LogicalMessage{watermark(window.lowWatermark())}); n != 1 {
+		t.Fatalf("expected 1 watermark, got %d", n)
+	}
+	n := worker.observeSnapshot(LSN(3), []LogicalMessage{
+		&BeginMessage{},
+		&UpdateMessage{Relation: relation, New: newSnapshotTestTuple("2", "y")},
+		&DeleteMessage{Relation: relation, Old: Tuple{{Name: "id", Kind: TupleDataTypeText, Data: []byte("3")}}},
+		&InsertMessage{Relation: other, New: newSnapshotTestTuple("4", "z")},
+		&CommitMessage{},
+	})
+	if n != 0 {
+		t.Fatalf("expected no watermark, got %d", n)
+	}
+	if len(received) != 0 {
+		t.Fatalf("expected no row before the high watermark, got %d", len(received))
+	}
+
+	worker.observeSnapshot(LSN(4), []LogicalMessage{watermark(window.highWatermark())})
+
+	select {
+	case <-window.done:
+	default:
+		t.Fatal("expected the window to be done")
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(received))
+	}
+	for i, id := range []string{"1", "4"} {
+		msg := received[i]
+		if !msg.IsSnapshot() || msg.StartLSN() != LSN(4) {
+			t.Errorf("unexpected message %+v", msg)
+		}
+		msgs, err := msg.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		read := msgs[0].(*ReadMessage)
+		if col, _ := read.New.Get("id"); col.String() != id {
+			t.Errorf("expected row %s, got %s", id, col.String())
+		}
+	}
+
+	// a replayed high watermark is ignored
+	worker.observeSnapshot(LSN(4), []LogicalMessage{watermark(window.highWatermark())})
+	if len(received) != 2 {
+		t.Errorf("expected 2 rows, got %d", len(received))
+	}
+}
+
+func TestSnapshotWindow_Truncate(t *testing.T) {
+	relation := newSnapshotTestRelation()
+
+	window, err := newSnapshotWindow(relation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	window.setRows([]*ReadMessage{
+		{Relation: relation, New: newSnapshotTestTuple("1", "a")},
+	})
+	window.begin()
+	window.observe(&TruncateMessage{Relations: []*RelationMessage{{Namespace: "public", RelationName: "orders"}}})
+
+	if rows := window.end(); len(rows) != 0 {
+		t.Errorf("expected no rows after a truncate, got %d", len(rows))
+	}
+}
+
+func TestSnapshotReader_ReadChunk(t *testing.T) {
+	table := &standInTable{rows: [][]string{{"3", "c"}}}
+	server := &standInServer{Handle: standInExec(table.exec)}
+	server.start(t)
+
+	conn := connectStandIn(t, server)
+	reader := &snapshotReader{
+		conn:      conn,
+		relations: NewRelationCache(),
+		batchSize: 2,
+	}
+
+	relation := newSnapshotTestRelation()
+	rows, err := reader.readChunk(context.Background(), relation, newSnapshotTestTuple("it's", "b"), 2, func(*ReadMessage) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Errorf("expected 1 row, got %d", rows)
+	}
+
+	expected := `DECLARE ` + __SNAPSHOT_CURSOR_NAME + ` NO SCROLL CURSOR FOR SELECT * FROM "public"."orders" WHERE ("id") > ('it''s') ORDER BY "id" LIMIT 2;`
+	if q := table.queries[0]; q != expected {
+		t.Errorf("unexpected query\n%s\nexpected\n%s", q, expected)
+	}
+}
+
+func TestConsumerPollingWorker_WatermarkAfterUnackedMessage(t *testing.T) {
+	const watermark = "message: transactional: 0 prefix: " + SnapshotWatermarkPrefix + ", sz: 3 content:low"
+
+	var (
+		received []*Message
+		consumer = newTestConsumer(&Config{AckMode: ManualAck})
+	)
+	consumer.MessageHandler = func(msg *Message) {
+		received = append(received, msg)
+	}
+	consumer.Decoder = new(TestDecodingDecoder)
+	worker := newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000))
+
+	worker.processData(newXLogDataTestMessage(LSN(0x2000), "table public.orders: INSERT: id[integer]:1"))
+	worker.processData(newXLogDataTestMessage(LSN(0x2100), watermark))
+
+	if len(received) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(received))
+	}
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x1000) {
+		t.Fatalf("expected flushed %s while the message is unacknowledged, got %s", LSN(0x1000), p.Flushed)
+	}
+
+	received[0].Delegate.OnAck(received[0])
+	worker.sendAcks()
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x2100) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x2100), p.Flushed)
+	}
+}
+
+func TestConsumerPollingWorker_WatermarkAfterUnackedTransaction(t *testing.T) {
+	const watermark = "message: transactional: 0 prefix: " + SnapshotWatermarkPrefix + ", sz: 3 content:low"
+
+	var (
+		received []*Transaction
+		consumer = newTestConsumer(&Config{AckMode: ManualAck})
+	)
+	consumer.TransactionHandler = func(tx *Transaction) {
+		received = append(received, tx)
+	}
+	consumer.Decoder = new(TestDecodingDecoder)
+	worker := newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000))
+
+	worker.processData(newXLogDataTestMessage(LSN(0x2000), "BEGIN 42"))
+	worker.processData(newXLogDataTestMessage(LSN(0x2100), "table public.orders: INSERT: id[integer]:1"))
+	worker.processData(newXLogDataTestMessage(LSN(0x2200), "COMMIT 42"))
+	worker.processData(newXLogDataTestMessage(LSN(0x2300), watermark))
+
+	if len(received) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(received))
+	}
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x1000) {
+		t.Fatalf("expected flushed %s while the transaction is unacknowledged, got %s", LSN(0x1000), p.Flushed)
+	}
+
+	received[0].Delegate.OnAck(received[0])
+	worker.sendAcks()
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x2300) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x2300), p.Flushed)
+	}
+}
@@ -0,0 +1,75 @@
+package postgres
+
+var _ SlotOffsetInfo = InitialSnapshot{}
+
+// InitialSnapshot subscribes a logical slot together with the existing
+// contents of Tables. When the slot does not exist yet, it is created
+// with an exported snapshot, the tables are read inside that snapshot on
+// a separate regular connection and delivered to the MessageHandler as
+// ReadMessage rows, and streaming then starts at the slot's consistent
+// point. When the slot already exists, the tables are not read again and
+// streaming resumes from the slot as usual.
+//
+// The snapshot is exported from a temporary slot, which is copied to Slot
+// only after every table has been delivered. A load that fails or stops
+// leaves no slot behind, so the next Subscribe loads the snapshot again.
+// Copying a slot requires PostgreSQL 12 or later.
+//
+// The snapshot can only be imported on the server that created the
+// slot; with several Config.Hosts, TargetSessionAttrs must select a
+// single server, e.g. the primary.
+type InitialSnapshot struct {
+	Slot      string
+	Plugin    string
+	Temporary bool
+	// Tables lists the tables to read, e.g. "orders" or "public.orders",
+	// in the order they are delivered.
+	Tables []string
+	// BatchSize is the number of rows fetched at once; zero means
+	// DefaultSnapshotBatchSize.
+	BatchSize int
+}
+
+// getSlotOffset implements SlotOffsetInfo.
+func (s InitialSnapshot) getSlotOffset() SlotOffset {
+	return SlotOffset{
+		Slot:     s.Slot,
+		LSN:      StreamUnspecifiedOffset,
+		snapshot: &s,
+	}
+}
+
+func (s *InitialSnapshot) createSource() CreateReplicationSlotSource {
+	return CreateReplicationSlotSource{
+		SlotName:       s.loadingSlot(),
+		Plugin:         s.Plugin,
+		Temporary:      true,
+		SlotType:       LogicalReplication,
+		SnapshotAction: ExportSnapshot,
+	}
+}
+
+// loadingSlot is the temporary slot the snapshot is exported from. A
+// Temporary InitialSnapshot streams from it directly.
+func (s *InitialSnapshot) loadingSlot() string {
+	if s.Temporary {
+		return s.Slot
+	}
+	return s.Slot + __SNAPSHOT_SLOT_SUFFIX
+}
+
+func (s *InitialSnapshot) batchSize() int {
+	if s.BatchSize <= 0 {
+		return DefaultSnapshotBatchSize
+	}
+	return s.BatchSize
+}
+
+// snapshotLoad is an initial snapshot waiting to be read before the
+// slot starts streaming.
+type snapshotLoad struct {
+	*InitialSnapshot
+
+	name            string
+	consistentPoint LSN
+}
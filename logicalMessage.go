@@ -0,0 +1,213 @@
+package postgres
+
+import (
+	"time"
+)
+
+var (
+	_ LogicalMessage = new(BeginMessage)
+	_ LogicalMessage = new(CommitMessage)
+	_ LogicalMessage = new(OriginMessage)
+	_ LogicalMessage = new(RelationMessage)
+	_ LogicalMessage = new(TypeMessage)
+	_ LogicalMessage = new(InsertMessage)
+	_ LogicalMessage = new(UpdateMessage)
+	_ LogicalMessage = new(DeleteMessage)
+	_ LogicalMessage = new(TruncateMessage)
+	_ LogicalMessage = new(LogicalDecodingMessage)
+	_ LogicalMessage = new(ReadMessage)
+)
+
+type MessageType byte
+
+const (
+	MessageTypeBegin    MessageType = 'B'
+	MessageTypeCommit   MessageType = 'C'
+	MessageTypeOrigin   MessageType = 'O'
+	MessageTypeRelation MessageType = 'R'
+	MessageTypeType     MessageType = 'Y'
+	MessageTypeInsert   MessageType = 'I'
+	MessageTypeUpdate   MessageType = 'U'
+	MessageTypeDelete   MessageType = 'D'
+	MessageTypeTruncate MessageType = 'T'
+	MessageTypeMessage  MessageType = 'M'
+	MessageTypeRead     MessageType = 'r'
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MessageTypeBegin:
+		return "Begin"
+	case MessageTypeCommit:
+		return "Commit"
+	case MessageTypeOrigin:
+		return "Origin"
+	case MessageTypeRelation:
+		return "Relation"
+	case MessageTypeType:
+		return "Type"
+	case MessageTypeInsert:
+		return "Insert"
+	case MessageTypeUpdate:
+		return "Update"
+	case MessageTypeDelete:
+		return "Delete"
+	case MessageTypeTruncate:
+		return "Truncate"
+	case MessageTypeMessage:
+		return "Message"
+	case MessageTypeRead:
+		return "Read"
+	}
+	return "Unknown"
+}
+
+type BeginMessage struct {
+	FinalLSN   LSN
+	CommitTime time.Time
+	Xid        uint32
+}
+
+// Type implements LogicalMessage.
+func (m *BeginMessage) Type() MessageType {
+	return MessageTypeBegin
+}
+
+type CommitMessage struct {
+	CommitLSN         LSN
+	TransactionEndLSN LSN
+	CommitTime        time.Time
+}
+
+// Type implements LogicalMessage.
+func (m *CommitMessage) Type() MessageType {
+	return MessageTypeCommit
+}
+
+type OriginMessage struct {
+	CommitLSN LSN
+	Name      string
+}
+
+// Type implements LogicalMessage.
+func (m *OriginMessage) Type() MessageType {
+	return MessageTypeOrigin
+}
+
+type RelationColumn struct {
+	Name         string
+	DataType     uint32
+	TypeName     string
+	TypeModifier int32
+	Key          bool
+}
+
+type RelationMessage struct {
+	RelationID      uint32
+	Namespace       string
+	RelationName    string
+	ReplicaIdentity uint8
+	Columns         []RelationColumn
+}
+
+// Type implements LogicalMessage.
+func (m *RelationMessage) Type() MessageType {
+	return MessageTypeRelation
+}
+
+func (m *RelationMessage) QualifiedName() string {
+	if len(m.Namespace) == 0 {
+		return m.RelationName
+	}
+	return m.Namespace + "." + m.RelationName
+}
+
+func (m *RelationMessage) KeyColumns() []string {
+	var keys []string
+	for _, c := range m.Columns {
+		if c.Key {
+			keys = append(keys, c.Name)
+		}
+	}
+	return keys
+}
+
+type TypeMessage struct {
+	DataType  uint32
+	Namespace string
+	Name      string
+}
+
+// Type implements LogicalMessage.
+func (m *TypeMessage) Type() MessageType {
+	return MessageTypeType
+}
+
+type InsertMessage struct {
+	Relation *RelationMessage
+	New      Tuple
+}
+
+// Type implements LogicalMessage.
+func (m *InsertMessage) Type() MessageType {
+	return MessageTypeInsert
+}
+
+type UpdateMessage struct {
+	Relation *RelationMessage
+	// Old holds either the replica identity key columns or, with
+	// REPLICA IDENTITY FULL, the whole old row. It is nil when the
+	// server did not send the old values.
+	Old Tuple
+	New Tuple
+}
+
+// Type implements LogicalMessage.
+func (m *UpdateMessage) Type() MessageType {
+	return MessageTypeUpdate
+}
+
+type DeleteMessage struct {
+	Relation *RelationMessage
+	Old      Tuple
+}
+
+// Type implements LogicalMessage.
+func (m *DeleteMessage) Type() MessageType {
+	return MessageTypeDelete
+}
+
+type TruncateMessage struct {
+	Relations       []*RelationMessage
+	Cascade         bool
+	RestartIdentity bool
+}
+
+// Type implements LogicalMessage.
+func (m *TruncateMessage) Type() MessageType {
+	return MessageTypeTruncate
+}
+
+type LogicalDecodingMessage struct {
+	LSN           LSN
+	Transactional bool
+	Prefix        string
+	Content       []byte
+}
+
+// Type implements LogicalMessage.
+func (m *LogicalDecodingMessage) Type() MessageType {
+	return MessageTypeMessage
+}
+
+// ReadMessage is a row read from a table by a snapshot rather than
+// decoded from the WAL.
+type ReadMessage struct {
+	Relation *RelationMessage
+	New      Tuple
+}
+
+// Type implements LogicalMessage.
+func (m *ReadMessage) Type() MessageType {
+	return MessageTypeRead
+}
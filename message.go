@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"fmt"
 	"sync/atomic"
 	"time"
 
@@ -20,6 +21,11 @@ type Message struct {
 	data            *pglogrepl.XLogData
 	database        string
 	systemID        string
+	decoded         []LogicalMessage
+	decodeErr       error
+	decodable       bool
+	ackEntry        *ackEntry
+	snapshot        bool
 
 	responded int32
 }
@@ -44,6 +50,22 @@ func (m *Message) Body() []byte {
 	return m.data.WALData
 }
 
+// Decode returns the logical messages decoded from Body() by the
+// Consumer.Decoder.
+func (m *Message) Decode() ([]LogicalMessage, error) {
+	if !m.decodable {
+		return nil, fmt.Errorf("no MessageDecoder configured on slot '%s'", m.Slot)
+	}
+	return m.decoded, m.decodeErr
+}
+
+// IsSnapshot reports whether the message is a row read by a snapshot
+// rather than a change streamed from the WAL. Decode returns a single
+// *ReadMessage for such a message and Body is empty.
+func (m *Message) IsSnapshot() bool {
+	return m.snapshot
+}
+
 func (m *Message) HasResponded() bool {
 	return atomic.LoadInt32(&m.responded) == 1
 }
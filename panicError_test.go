@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+)
+
+func newPanicTestWorker(policy PoisonMessagePolicy) (*consumerPollingWorker, *[]*ConsumerError) {
+	var (
+		failures []*ConsumerError
+		consumer = newTestConsumer(&Config{PoisonMessagePolicy: policy})
+	)
+	consumer.ErrorHandler = func(err *ConsumerError) ErrorDecision {
+		failures = append(failures, err)
+		return ErrorContinue
+	}
+	consumer.MessageHandler = func(msg *Message) {
+		if string(msg.Body()) == "poison" {
+			panic("malformed row")
+		}
+	}
+	return newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000)), &failures
+}
+
+func processPanicTestMessage(worker *consumerPollingWorker, lsn LSN, body string) bool {
+	return worker.processMessage(lsn, pglogrepl.XLogData{
+		WALStart:     lsn,
+		ServerWALEnd: lsn,
+		WALData:      []byte(body),
+	})
+}
+
+func TestConsumerPollingWorker_PoisonMessageStopSlot(t *testing.T) {
+	worker, failures := newPanicTestWorker(PoisonMessageStopSlot)
+
+	processPanicTestMessage(worker, LSN(0x2000), "poison")
+
+	if len(*failures) != 1 {
+		t.Fatalf("expected 1 error, got %+v", *failures)
+	}
+	var (
+		failure  = (*failures)[0]
+		panicErr *PanicError
+	)
+	if failure.Phase != ErrorPhaseHandle || failure.LSN != LSN(0x2000) || !errors.As(failure, &panicErr) {
+		t.Fatalf("unexpected error %+v", failure)
+	}
+	if panicErr.Value != "malformed row" || len(panicErr.Stack) == 0 {
+		t.Errorf("unexpected panic %v", panicErr.Value)
+	}
+	if worker.tracker.Pending() != 1 {
+		t.Errorf("expected the message to stay unacknowledged")
+	}
+	if worker.resolveFailure(context.Background()) {
+		t.Error("expected the slot to stop")
+	}
+	if worker.consumer.ctx.Err() != nil {
+		t.Error("expected the Consumer to go on")
+	}
+}
+
+func TestConsumerPollingWorker_PoisonMessageSkip(t *testing.T) {
+	worker, failures := newPanicTestWorker(PoisonMessageSkip)
+
+	processPanicTestMessage(worker, LSN(0x2000), "poison")
+
+	if len(*failures) != 1 {
+		t.Fatalf("expected 1 error, got %+v", *failures)
+	}
+	if worker.tracker.Pending() != 0 {
+		t.Errorf("expected the message to be acknowledged")
+	}
+	if !worker.resolveFailure(context.Background()) {
+		t.Fatal("expected the worker to go on")
+	}
+	if !processPanicTestMessage(worker, LSN(0x3000), "row") {
+		t.Error("expected the next message to be delivered")
+	}
+}
+
+func TestConsumerPollingWorker_PoisonMessageDeadLetter(t *testing.T) {
+	worker, _ := newPanicTestWorker(PoisonMessageDeadLetter)
+
+	var letters []DeadLetter
+	worker.DeadLetterHandler = func(letter *DeadLetter) error {
+		letters = append(letters, *letter)
+		return nil
+	}
+
+	processPanicTestMessage(worker, LSN(0x2000), "poison")
+
+	if len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(letters))
+	}
+	var (
+		letter   = letters[0]
+		panicErr *PanicError
+	)
+	if letter.Slot != "orders" || letter.LSN != LSN(0x2000) || letter.Message == nil || letter.Transaction != nil {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+	if !errors.As(letter.Err, &panicErr) || !strings.Contains(string(panicErr.Stack), "panicError_test.go") {
+		t.Errorf("expected a stack trace, got %v", letter.Err)
+	}
+	if worker.tracker.Pending() != 0 {
+		t.Errorf("expected the message to be acknowledged")
+	}
+	if !worker.resolveFailure(context.Background()) {
+		t.Error("expected the worker to go on")
+	}
+}
+
+func TestConsumerPollingWorker_PoisonMessageDeadLetterFailed(t *testing.T) {
+	worker, failures := newPanicTestWorker(PoisonMessageDeadLetter)
+	worker.DeadLetterHandler = func(letter *DeadLetter) error {
+		return errors.New("sink unavailable")
+	}
+
+	processPanicTestMessage(worker, LSN(0x2000), "poison")
+
+	if len(*failures) != 2 {
+		t.Fatalf("expected 2 errors, got %+v", *failures)
+	}
+	if worker.tracker.Pending() != 1 {
+		t.Errorf("expected the message to stay unacknowledged")
+	}
+	if worker.resolveFailure(context.Background()) {
+		t.Error("expected the slot to stop")
+	}
+}
+
+func TestConsumerPollingWorker_EventHandlerPanic(t *testing.T) {
+	worker, failures := newPanicTestWorker(PoisonMessageStopSlot)
+	worker.EventHandler = func(event Event) error {
+		panic(errors.New("event handler bug"))
+	}
+
+	worker.processEvent(&ReconnectedEvent{Slot: "orders"})
+
+	if len(*failures) != 1 {
+		t.Fatalf("expected 1 error, got %+v", *failures)
+	}
+	var panicErr *PanicError
+	if failure := (*failures)[0]; failure.Phase != ErrorPhaseHandle || !errors.As(failure, &panicErr) {
+		t.Errorf("unexpected error %+v", failure)
+	}
+	if !worker.resolveFailure(context.Background()) {
+		t.Error("expected the worker to go on")
+	}
+}
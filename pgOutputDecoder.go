@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/jackc/pglogrepl"
+)
+
+var _ MessageDecoder = new(PgOutputDecoder)
+
+type PgOutputDecoder struct{}
+
+// Decode implements MessageDecoder.
+func (d *PgOutputDecoder) Decode(relations *RelationCache, data []byte) ([]LogicalMessage, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty pgoutput message")
+	}
+
+	raw, err := pglogrepl.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg LogicalMessage
+	switch v := raw.(type) {
+	case *pglogrepl.BeginMessage:
+		msg = &BeginMessage{
+			FinalLSN:   v.FinalLSN,
+			CommitTime: v.CommitTime,
+			Xid:        v.Xid,
+		}
+	case *pglogrepl.CommitMessage:
+		msg = &CommitMessage{
+			CommitLSN:         v.CommitLSN,
+			TransactionEndLSN: v.TransactionEndLSN,
+			CommitTime:        v.CommitTime,
+		}
+	case *pglogrepl.OriginMessage:
+		msg = &OriginMessage{
+			CommitLSN: v.CommitLSN,
+			Name:      v.Name,
+		}
+	case *pglogrepl.RelationMessage:
+		r := &RelationMessage{
+			RelationID:      v.RelationID,
+			Namespace:       v.Namespace,
+			RelationName:    v.RelationName,
+			ReplicaIdentity: v.ReplicaIdentity,
+			Columns:         make([]RelationColumn, len(v.Columns)),
+		}
+		for i, c := range v.Columns {
+			r.Columns[i] = RelationColumn{
+				Name:         c.Name,
+				DataType:     c.DataType,
+				TypeModifier: c.TypeModifier,
+				Key:          c.Flags&1 == 1,
+			}
+		}
+		relations.putRelation(r)
+		msg = r
+	case *pglogrepl.TypeMessage:
+		t := &TypeMessage{
+			DataType:  v.DataType,
+			Namespace: v.Namespace,
+			Name:      v.Name,
+		}
+		relations.putType(t)
+		msg = t
+	case *pglogrepl.InsertMessage:
+		r, err := d.resolveRelation(relations, v.RelationID)
+		if err != nil {
+			return nil, err
+		}
+		msg = &InsertMessage{
+			Relation: r,
+			New:      d.resolveTuple(r, v.Tuple),
+		}
+	case *pglogrepl.UpdateMessage:
+		r, err := d.resolveRelation(relations, v.RelationID)
+		if err != nil {
+			return nil, err
+		}
+		msg = &UpdateMessage{
+			Relation: r,
+			Old:      d.resolveTuple(r, v.OldTuple),
+			New:      d.resolveTuple(r, v.NewTuple),
+		}
+	case *pglogrepl.DeleteMessage:
+		r, err := d.resolveRelation(relations, v.RelationID)
+		if err != nil {
+			return nil, err
+		}
+		msg = &DeleteMessage{
+			Relation: r,
+			Old:      d.resolveTuple(r, v.OldTuple),
+		}
+	case *pglogrepl.TruncateMessage:
+		m := &TruncateMessage{
+			Relations:       make([]*RelationMessage, len(v.RelationIDs)),
+			Cascade:         v.Option&pglogrepl.TruncateOptionCascade != 0,
+			RestartIdentity: v.Option&pglogrepl.TruncateOptionRestartIdentity != 0,
+		}
+		for i, id := range v.RelationIDs {
+			r, err := d.resolveRelation(relations, id)
+			if err != nil {
+				return nil, err
+			}
+			m.Relations[i] = r
+		}
+		msg = m
+	case *pglogrepl.LogicalDecodingMessage:
+		msg = &LogicalDecodingMessage{
+			LSN:           v.LSN,
+			Transactional: v.Transactional,
+			Prefix:        v.Prefix,
+			Content:       v.Content,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported pgoutput message type '%c'", data[0])
+	}
+	return []LogicalMessage{msg}, nil
+}
+
+func (d *PgOutputDecoder) resolveRelation(relations *RelationCache, id uint32) (*RelationMessage, error) {
+	r, ok := relations.Relation(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown relation id %d", id)
+	}
+	return r, nil
+}
+
+func (d *PgOutputDecoder) resolveTuple(relation *RelationMessage, data *pglogrepl.TupleData) Tuple {
+	if data == nil {
+		return nil
+	}
+
+	var tuple = make(Tuple, len(data.Columns))
+	for i, c := range data.Columns {
+		col := TupleColumn{
+			Kind: c.DataType,
+			Data: c.Data,
+		}
+		if i < len(relation.Columns) {
+			col.Name = relation.Columns[i].Name
+			col.DataType = relation.Columns[i].DataType
+			col.TypeName = relation.Columns[i].TypeName
+		}
+		tuple[i] = col
+	}
+	return tuple
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func encodePgOutputRelation(id uint32, namespace, name string, columns ...string) []byte {
+	var buf = []byte{'R'}
+	buf = binary.BigEndian.AppendUint32(buf, id)
+	buf = append(append(buf, namespace...), 0)
+	buf = append(append(buf, name...), 0)
+	buf = append(buf, 'd')
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(columns)))
+	for i, c := range columns {
+		var flags byte
+		if i == 0 {
+			flags = 1
+		}
+		buf = append(buf, flags)
+		buf = append(append(buf, c...), 0)
+		buf = binary.BigEndian.AppendUint32(buf, 25) // text
+		buf = binary.BigEndian.AppendUint32(buf, 0xFFFFFFFF)
+	}
+	return buf
+}
+
+func encodePgOutputInsert(id uint32, values ...string) []byte {
+	var buf = []byte{'I'}
+	buf = binary.BigEndian.AppendUint32(buf, id)
+	buf = append(buf, 'N')
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(values)))
+	for _, v := range values {
+		buf = append(buf, 't')
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+		buf = append(buf, v...)
+	}
+	return buf
+}
+
+func TestPgOutputDecoder(t *testing.T) {
+	var (
+		decoder   = new(PgOutputDecoder)
+		relations = NewRelationCache()
+	)
+
+	msgs, err := decoder.Decode(relations, encodePgOutputRelation(16384, "public", "foo", "id", "name"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Type() != MessageTypeRelation {
+		t.Fatalf("expected a Relation message, got %+v", msgs)
+	}
+	if relations.Len() != 1 {
+		t.Fatalf("expected 1 cached relation, got %d", relations.Len())
+	}
+
+	msgs, err = decoder.Decode(relations, encodePgOutputInsert(16384, "1", "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert, ok := msgs[0].(*InsertMessage)
+	if !ok {
+		t.Fatalf("expected *InsertMessage, got %T", msgs[0])
+	}
+	if insert.Relation.QualifiedName() != "public.foo" {
+		t.Errorf("expected relation 'public.foo', got '%s'", insert.Relation.QualifiedName())
+	}
+	if keys := insert.Relation.KeyColumns(); len(keys) != 1 || keys[0] != "id" {
+		t.Errorf("expected key columns [id], got %v", keys)
+	}
+	col, ok := insert.New.Get("name")
+	if !ok || col.String() != "x" || col.TypeName != "text" {
+		t.Errorf("unexpected column 'name': %+v", col)
+	}
+}
+
+func TestPgOutputDecoder_UnknownRelation(t *testing.T) {
+	_, err := new(PgOutputDecoder).Decode(NewRelationCache(), encodePgOutputInsert(1, "1"))
+	if err == nil {
+		t.Fatal("expected error for unknown relation")
+	}
+}
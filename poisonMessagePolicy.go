@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PoisonMessagePolicy decides what happens to a message or transaction
+// whose handler panics. The panic is reported to the ErrorHandler as a
+// *PanicError in ErrorPhaseHandle first; a decision other than
+// ErrorContinue takes precedence over the policy.
+type PoisonMessagePolicy int
+
+const (
+	// PoisonMessageStopSlot stops streaming the slot without
+	// acknowledging the message, so it is redelivered after a restart.
+	PoisonMessageStopSlot PoisonMessagePolicy = iota
+	// PoisonMessageSkip acknowledges the message and goes on.
+	PoisonMessageSkip
+	// PoisonMessageDeadLetter passes the message to the
+	// Consumer.DeadLetterHandler, then acknowledges it and goes on. The
+	// slot stops when the DeadLetterHandler fails.
+	PoisonMessageDeadLetter
+)
+
+func (p PoisonMessagePolicy) String() string {
+	switch p {
+	case PoisonMessageStopSlot:
+		return "stop"
+	case PoisonMessageSkip:
+		return "skip"
+	case PoisonMessageDeadLetter:
+		return "dead-letter"
+	}
+	return fmt.Sprintf("PoisonMessagePolicy(%d)", int(p))
+}
+
+func ParsePoisonMessagePolicy(s string) (PoisonMessagePolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "stop":
+		return PoisonMessageStopSlot, nil
+	case "skip":
+		return PoisonMessageSkip, nil
+	case "dead-letter":
+		return PoisonMessageDeadLetter, nil
+	}
+	return 0, fmt.Errorf("unsupported poison message policy '%s'", s)
+}
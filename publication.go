@@ -0,0 +1,245 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CreatePublication creates every publication of the provider.
+func CreatePublication(ctx context.Context, conn *pgconn.PgConn, provider CreatePublicationSourceProvider) error {
+	for _, source := range provider.sources {
+		sql, err := createPublicationSQL(source, serverMajorVersion(conn))
+		if err != nil {
+			return err
+		}
+		if _, err = conn.Exec(ctx, sql).ReadAll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func AlterPublicationAddTables(ctx context.Context, conn *pgconn.PgConn, publication string, tables ...PublicationTable) error {
+	if len(tables) == 0 {
+		return nil
+	}
+
+	list, err := publicationTablesSQL(tables, serverMajorVersion(conn))
+	if err != nil {
+		return err
+	}
+	sql := "ALTER PUBLICATION " + quoteIdentifier(publication) + " ADD TABLE " + list + ";"
+	_, err = conn.Exec(ctx, sql).ReadAll()
+	return err
+}
+
+func AlterPublicationDropTables(ctx context.Context, conn *pgconn.PgConn, publication string, tables ...string) error {
+	if len(tables) == 0 {
+		return nil
+	}
+
+	var names = make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = quoteQualifiedName(t)
+	}
+	sql := "ALTER PUBLICATION " + quoteIdentifier(publication) + " DROP TABLE " + strings.Join(names, ", ") + ";"
+	_, err := conn.Exec(ctx, sql).ReadAll()
+	return err
+}
+
+func DropPublication(ctx context.Context, conn *pgconn.PgConn, publication string) error {
+	_, err := conn.Exec(ctx, "DROP PUBLICATION "+quoteIdentifier(publication)+";").ReadAll()
+	return err
+}
+
+// ListPublications returns every publication of the database together
+// with its tables. Column lists, row filters and schemas are only read
+// from PostgreSQL 15 on.
+func ListPublications(ctx context.Context, conn *pgconn.PgConn) ([]PublicationSource, error) {
+	results, err := conn.Exec(ctx, __SQL_SELECT_PUBLICATIONS).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		records []PublicationSource
+		index   = make(map[string]int)
+	)
+	for _, r := range results {
+		for _, v := range r.Rows {
+			record := PublicationSource{
+				PublicationName: string(v[0]),
+				AllTables:       parsePgBool(v[1]),
+				Insert:          parsePgBool(v[2]),
+				Update:          parsePgBool(v[3]),
+				Delete:          parsePgBool(v[4]),
+				Truncate:        parsePgBool(v[5]),
+			}
+			index[record.PublicationName] = len(records)
+			records = append(records, record)
+		}
+	}
+
+	var filters = "NULL, NULL"
+	if serverMajorVersion(conn) >= 15 {
+		filters = __SQL_PUBLICATION_TABLE_FILTERS
+	}
+	results, err = conn.Exec(ctx, fmt.Sprintf(__SQL_SELECT_PUBLICATION_TABLES, filters)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		for _, v := range r.Rows {
+			i, ok := index[string(v[0])]
+			if !ok {
+				continue
+			}
+			table := PublicationTable{
+				Name:  string(v[1]) + "." + string(v[2]),
+				Where: string(v[4]),
+			}
+			if v[3] != nil {
+				table.Columns = parseTextArray(string(v[3]))
+			}
+			records[i].Tables = append(records[i].Tables, table)
+		}
+	}
+
+	if serverMajorVersion(conn) < 15 {
+		return records, nil
+	}
+	results, err = conn.Exec(ctx, __SQL_SELECT_PUBLICATION_SCHEMAS).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		for _, v := range r.Rows {
+			if i, ok := index[string(v[0])]; ok {
+				records[i].Schemas = append(records[i].Schemas, string(v[1]))
+			}
+		}
+	}
+	return records, nil
+}
+
+func createPublicationSQL(source CreatePublicationSource, version int) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("CREATE PUBLICATION ")
+	sb.WriteString(quoteIdentifier(source.PublicationName))
+
+	switch {
+	case source.AllTables && len(source.Tables) > 0:
+		return "", fmt.Errorf("publication '%s' cannot list tables FOR ALL TABLES", source.PublicationName)
+	case source.AllTables:
+		sb.WriteString(" FOR ALL TABLES")
+	case len(source.Tables) > 0:
+		list, err := publicationTablesSQL(source.Tables, version)
+		if err != nil {
+			return "", fmt.Errorf("publication '%s': %w", source.PublicationName, err)
+		}
+		sb.WriteString(" FOR TABLE ")
+		sb.WriteString(list)
+	}
+
+	if len(source.Publish) > 0 {
+		for _, op := range source.Publish {
+			switch strings.ToLower(op) {
+			case "insert", "update", "delete", "truncate":
+			default:
+				return "", fmt.Errorf("publication '%s': unsupported publish operation '%s'", source.PublicationName, op)
+			}
+		}
+		sb.WriteString(" WITH (publish = '")
+		sb.WriteString(strings.ToLower(strings.Join(source.Publish, ", ")))
+		sb.WriteString("')")
+	}
+	sb.WriteString(";")
+	return sb.String(), nil
+}
+
+func publicationTablesSQL(tables []PublicationTable, version int) (string, error) {
+	var list = make([]string, len(tables))
+	for i, t := range tables {
+		if len(t.Name) == 0 {
+			return "", fmt.Errorf("table %d has no name", i)
+		}
+		if (len(t.Columns) > 0 || len(t.Where) > 0) && version > 0 && version < 15 {
+			return "", fmt.Errorf("table '%s': column lists and row filters require PostgreSQL 15", t.Name)
+		}
+
+		item := quoteQualifiedName(t.Name)
+		if len(t.Columns) > 0 {
+			var columns = make([]string, len(t.Columns))
+			for j, c := range t.Columns {
+				columns[j] = quoteIdentifier(c)
+			}
+			item += " (" + strings.Join(columns, ", ") + ")"
+		}
+		if len(t.Where) > 0 {
+			item += " WHERE (" + t.Where + ")"
+		}
+		list[i] = item
+	}
+	return strings.Join(list, ", "), nil
+}
+
+// quoteQualifiedName quotes "schema.table" or "table". A name that
+// already contains double quotes is used as written.
+func quoteQualifiedName(name string) string {
+	if strings.Contains(name, `"`) {
+		return name
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return quoteIdentifier(name[:i]) + "." + quoteIdentifier(name[i+1:])
+	}
+	return quoteIdentifier(name)
+}
+
+// serverMajorVersion returns the major version reported by the server,
+// or 0 when it is unknown.
+func serverMajorVersion(conn *pgconn.PgConn) int {
+	var version = conn.ParameterStatus("server_version")
+	if i := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		version = version[:i]
+	}
+	major, _ := strconv.Atoi(version)
+	return major
+}
+
+func parsePgBool(v []byte) bool {
+	return string(v) == "t" || string(v) == "true"
+}
+
+// parseTextArray parses the text form of a one-dimensional array of
+// identifiers, e.g. {id,"Order Id"}.
+func parseTextArray(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+	if len(s) == 0 {
+		return nil
+	}
+
+	var (
+		items  []string
+		sb     strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && quoted && i+1 < len(s):
+			i++
+			sb.WriteByte(s[i])
+		case c == ',' && !quoted:
+			items = append(items, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return append(items, sb.String())
+}
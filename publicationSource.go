@@ -0,0 +1,35 @@
+package postgres
+
+// PublicationSource is a publication as listed by ListPublications.
+// Tables is empty when AllTables is set.
+type PublicationSource struct {
+	PublicationName string
+	AllTables       bool
+	Insert          bool
+	Update          bool
+	Delete          bool
+	Truncate        bool
+	Tables          []PublicationTable
+	// Schemas lists the schemas published FOR TABLES IN SCHEMA; their
+	// tables are not in Tables.
+	Schemas []string
+}
+
+// Publish returns the published operations in the form of
+// CreatePublicationSource.Publish.
+func (s *PublicationSource) Publish() []string {
+	var ops []string
+	if s.Insert {
+		ops = append(ops, "insert")
+	}
+	if s.Update {
+		ops = append(ops, "update")
+	}
+	if s.Delete {
+		ops = append(ops, "delete")
+	}
+	if s.Truncate {
+		ops = append(ops, "truncate")
+	}
+	return ops
+}
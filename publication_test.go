@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCreatePublicationSQL(t *testing.T) {
+	cases := []struct {
+		source   CreatePublicationSource
+		version  int
+		expected string
+	}{
+		{
+			source:   CreatePublicationSource{PublicationName: "all", AllTables: true},
+			version:  14,
+			expected: `CREATE PUBLICATION "all" FOR ALL TABLES;`,
+		},
+		{
+			source: CreatePublicationSource{
+				PublicationName: "orders",
+				Tables: []PublicationTable{
+					{Name: "public.orders", Columns: []string{"id", "amount"}, Where: "amount > 0"},
+					{Name: `"Sales"."Order Lines"`},
+				},
+				Publish: []string{"insert", "UPDATE"},
+			},
+			version:  15,
+			expected: `CREATE PUBLICATION "orders" FOR TABLE "public"."orders" ("id", "amount") WHERE (amount > 0), "Sales"."Order Lines" WITH (publish = 'insert, update');`,
+		},
+		{
+			source:   CreatePublicationSource{PublicationName: "empty"},
+			expected: `CREATE PUBLICATION "empty";`,
+		},
+	}
+	for _, c := range cases {
+		sql, err := createPublicationSQL(c.source, c.version)
+		if err != nil {
+			t.Errorf("%s: %v", c.source.PublicationName, err)
+			continue
+		}
+		if sql != c.expected {
+			t.Errorf("unexpected SQL\n%s\nexpected\n%s", sql, c.expected)
+		}
+	}
+}
+
+func TestCreatePublicationSQL_Invalid(t *testing.T) {
+	for _, c := range []struct {
+		source  CreatePublicationSource
+		version int
+	}{
+		{CreatePublicationSource{PublicationName: "a", AllTables: true, Tables: []PublicationTable{{Name: "t"}}}, 15},
+		{CreatePublicationSource{PublicationName: "b", Tables: []PublicationTable{{Name: "t", Where: "id > 0"}}}, 14},
+		{CreatePublicationSource{PublicationName: "c", Publish: []string{"select"}}, 15},
+	} {
+		if _, err := createPublicationSQL(c.source, c.version); err == nil {
+			t.Errorf("expected error for %+v", c.source)
+		}
+	}
+}
+
+func TestCreatePublicationSourceProvider_Scan(t *testing.T) {
+	var p CreatePublicationSourceProvider
+	err := p.ScanString(`[
+	{
+		"PublicationName": "orders",
+		"Tables": [
+			{ "Name": "public.orders", "Columns": ["id", "amount"], "Where": "amount > 0" }
+		],
+		"Publish": ["insert", "update"]
+	},
+	{
+		"PublicationName": "everything",
+		"AllTables": true
+	}
+]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := p.Sources()
+	if len(sources) != 2 {
+		t.Fatalf("expected 2 sources, got %d", len(sources))
+	}
+	if s := sources[0]; s.PublicationName != "orders" || len(s.Tables) != 1 || s.Tables[0].Where != "amount > 0" || len(s.Tables[0].Columns) != 2 {
+		t.Errorf("unexpected source %+v", s)
+	}
+	if s := sources[1]; !s.AllTables {
+		t.Errorf("unexpected source %+v", s)
+	}
+}
+
+func TestListPublications(t *testing.T) {
+	server := &standInServer{
+		ServerParams: map[string]string{"server_version": "15.4"},
+		Handle: standInExec(func(query string) standInResult {
+			switch {
+			case strings.Contains(query, `FROM "pg_catalog"."pg_publication"`):
+				return standInResult{
+					Columns: []string{"pubname", "puballtables", "pubinsert", "pubupdate", "pubdelete", "pubtruncate"},
+					Rows: [][]string{
+						{"everything", "t", "t", "t", "t", "t"},
+						{"orders", "f", "t", "t", "f", "f"},
+						{"sales", "f", "t", "t", "t", "t"},
+					},
+				}
+			case strings.Contains(query, `"pg_publication_namespace"`):
+				return standInResult{
+					Columns: []string{"pubname", "nspname"},
+					Rows:    [][]string{{"sales", "sales"}, {"sales", "billing"}},
+				}
+			case strings.Contains(query, `"pg_publication_rel"`):
+				if !strings.Contains(query, "prqual") {
+					return standInResult{Error: "expected row filters", ErrorCode: "42601"}
+				}
+				return standInResult{
+					Columns: []string{"pubname", "nspname", "relname", "attnames", "rowfilter"},
+					Rows: [][]string{
+						{"orders", "public", "orders", `{id,"Order Amount"}`, "(amount > 0)"},
+						{"orders", "public", "customers", standInNull, standInNull},
+					},
+				}
+			}
+			return standInResult{Error: "unexpected query " + query, ErrorCode: "42601"}
+		}),
+	}
+	server.start(t)
+
+	records, err := ListPublications(context.Background(), connectStandIn(t, server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 publications, got %+v", records)
+	}
+	if r := records[0]; !r.AllTables || len(r.Publish()) != 4 || len(r.Tables) != 0 {
+		t.Errorf("unexpected publication %+v", r)
+	}
+
+	r := records[1]
+	if r.AllTables || strings.Join(r.Publish(), ",") != "insert,update" || len(r.Tables) != 2 {
+		t.Fatalf("unexpected publication %+v", r)
+	}
+	if tb := r.Tables[0]; tb.Name != "public.orders" || strings.Join(tb.Columns, ",") != "id,Order Amount" || tb.Where != "(amount > 0)" {
+		t.Errorf("unexpected table %+v", tb)
+	}
+	if tb := r.Tables[1]; tb.Name != "public.customers" || tb.Columns != nil || tb.Where != "" {
+		t.Errorf("unexpected table %+v", tb)
+	}
+	if r := records[2]; len(r.Tables) != 0 || strings.Join(r.Schemas, ",") != "sales,billing" {
+		t.Errorf("unexpected publication %+v", r)
+	}
+}
@@ -0,0 +1,388 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type ReconcileAction string
+
+const (
+	ReconcileCreate ReconcileAction = "create"
+	ReconcileDrop   ReconcileAction = "drop"
+	// ReconcileDrift marks an object that exists with other settings
+	// than desired. It is reported only; the object is left unchanged.
+	ReconcileDrift ReconcileAction = "drift"
+)
+
+const (
+	ReconcileSlot        = "slot"
+	ReconcilePublication = "publication"
+)
+
+// ReconcileStep is a single difference between the desired and the
+// actual state.
+type ReconcileStep struct {
+	Kind    string // ReconcileSlot or ReconcilePublication
+	Name    string
+	Action  ReconcileAction
+	Detail  string
+	Applied bool
+}
+
+func (s ReconcileStep) String() string {
+	var sign string
+	switch s.Action {
+	case ReconcileCreate:
+		sign = "+"
+	case ReconcileDrop:
+		sign = "-"
+	default:
+		sign = "~"
+	}
+
+	line := fmt.Sprintf("%s %s %s", sign, s.Kind, s.Name)
+	if len(s.Detail) > 0 {
+		line += ": " + s.Detail
+	}
+	return line
+}
+
+// ReconcilePlan lists the steps Reconcile took, or would take in dry-run
+// mode.
+type ReconcilePlan struct {
+	DryRun bool
+	Steps  []ReconcileStep
+}
+
+// HasChanges reports whether the plan creates or drops anything.
+func (p *ReconcilePlan) HasChanges() bool {
+	for _, s := range p.Steps {
+		if s.Action != ReconcileDrift {
+			return true
+		}
+	}
+	return false
+}
+
+// Drifted returns the steps of objects that differ from the desired
+// state.
+func (p *ReconcilePlan) Drifted() []ReconcileStep {
+	var steps []ReconcileStep
+	for _, s := range p.Steps {
+		if s.Action == ReconcileDrift {
+			steps = append(steps, s)
+		}
+	}
+	return steps
+}
+
+func (p *ReconcilePlan) String() string {
+	if len(p.Steps) == 0 {
+		return "no changes"
+	}
+
+	var lines = make([]string, 0, len(p.Steps)+1)
+	for _, s := range p.Steps {
+		lines = append(lines, s.String())
+	}
+	if p.DryRun {
+		lines = append(lines, "(dry run: nothing applied)")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Reconcile compares the slots of provider, and the publications given
+// with WithReconcilePublications, with the server. It creates the
+// missing ones and reports the ones whose plugin, slot type or
+// publication settings differ. Slots are created without exporting a
+// snapshot, and Temporary sources are rejected since their slots would
+// go with conn.
+//
+// WithReconcileDropUnmanaged also drops the slots the provider does not
+// list; physical slots, slots of other databases and active slots are
+// never dropped. Publications are only dropped with
+// WithReconcileDropPublications, and only the unlisted ones whose name
+// has its prefix. Publications FOR TABLES IN SCHEMA cannot be described
+// by a CreatePublicationSource and are left alone. With
+// WithReconcileDryRun nothing is changed and the plan only describes the
+// steps.
+//
+// Reconcile stops at the first failing step and returns the plan so far.
+func Reconcile(ctx context.Context, conn *pgconn.PgConn, provider CreateReplicationSlotSourceProvider, options ...ReconcileOption) (*ReconcilePlan, error) {
+	var opt reconcileOptions
+	for _, o := range options {
+		o.applyReconcileOptions(&opt)
+	}
+
+	var plan = &ReconcilePlan{DryRun: opt.dryRun}
+
+	for _, source := range provider.sources {
+		if source.Temporary {
+			return plan, fmt.Errorf("cannot reconcile temporary slot '%s'", source.SlotName)
+		}
+	}
+
+	database, err := currentDatabase(ctx, conn)
+	if err != nil {
+		return plan, err
+	}
+	if err = reconcileSlots(ctx, conn, provider, database, &opt, plan); err != nil {
+		return plan, err
+	}
+	if opt.publications != nil {
+		if err = reconcilePublications(ctx, conn, *opt.publications, &opt, plan); err != nil {
+			return plan, err
+		}
+	}
+	return plan, nil
+}
+
+func reconcileSlots(ctx context.Context, conn *pgconn.PgConn, provider CreateReplicationSlotSourceProvider, database string, opt *reconcileOptions, plan *ReconcilePlan) error {
+	var manager = NewSlotManager(conn)
+
+	records, err := manager.ListReplicationSlots(ctx)
+	if err != nil {
+		return err
+	}
+	var actual = make(map[string]ReplicationSlotSource, len(records))
+	for _, r := range records {
+		actual[r.SlotName] = r
+	}
+
+	var desired = make(map[string]bool)
+	for _, source := range provider.sources {
+		desired[source.SlotName] = true
+
+		slot, ok := actual[source.SlotName]
+		if !ok {
+			step := ReconcileStep{
+				Kind:   ReconcileSlot,
+				Name:   source.SlotName,
+				Action: ReconcileCreate,
+				Detail: describeSlot(source.SlotType, source.Plugin),
+			}
+			if !opt.dryRun {
+				// nothing imports the snapshot
+				source.SnapshotAction = ""
+				if source.SlotType == LogicalReplication {
+					source.SnapshotAction = NoExportSnapshot
+				}
+				if _, err := createReplicationSlot(ctx, conn, source); err != nil {
+					return err
+				}
+				step.Applied = true
+			}
+			plan.Steps = append(plan.Steps, step)
+			continue
+		}
+
+		var drift []string
+		if slot.SlotType != source.SlotType {
+			drift = append(drift, fmt.Sprintf("slot type is %s, want %s", slot.SlotType, source.SlotType))
+		} else if slot.SlotType == LogicalReplication && slot.Plugin != source.Plugin {
+			drift = append(drift, fmt.Sprintf("plugin is '%s', want '%s'", slot.Plugin, source.Plugin))
+		}
+		if slot.SlotType == LogicalReplication && len(slot.Database) > 0 && slot.Database != database {
+			drift = append(drift, fmt.Sprintf("database is '%s', want '%s'", slot.Database, database))
+		}
+		if len(drift) > 0 {
+			plan.Steps = append(plan.Steps, ReconcileStep{
+				Kind:   ReconcileSlot,
+				Name:   source.SlotName,
+				Action: ReconcileDrift,
+				Detail: strings.Join(drift, "; "),
+			})
+		}
+	}
+
+	if !opt.dropUnmanaged {
+		return nil
+	}
+	for _, slot := range records {
+		if desired[slot.SlotName] ||
+			slot.SlotType != LogicalReplication ||
+			slot.Database != database ||
+			slot.Active {
+			continue
+		}
+
+		step := ReconcileStep{
+			Kind:   ReconcileSlot,
+			Name:   slot.SlotName,
+			Action: ReconcileDrop,
+			Detail: describeSlot(slot.SlotType, slot.Plugin),
+		}
+		if !opt.dryRun {
+			if err := manager.DropReplicationSlot(ctx, slot.SlotName, false); err != nil {
+				return err
+			}
+			step.Applied = true
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	return nil
+}
+
+func reconcilePublications(ctx context.Context, conn *pgconn.PgConn, provider CreatePublicationSourceProvider, opt *reconcileOptions, plan *ReconcilePlan) error {
+	records, err := ListPublications(ctx, conn)
+	if err != nil {
+		return err
+	}
+	var actual = make(map[string]PublicationSource, len(records))
+	for _, r := range records {
+		actual[r.PublicationName] = r
+	}
+
+	var desired = make(map[string]bool)
+	for _, source := range provider.sources {
+		desired[source.PublicationName] = true
+
+		publication, ok := actual[source.PublicationName]
+		if !ok {
+			step := ReconcileStep{
+				Kind:   ReconcilePublication,
+				Name:   source.PublicationName,
+				Action: ReconcileCreate,
+			}
+			if source.AllTables {
+				step.Detail = "all tables"
+			} else {
+				step.Detail = fmt.Sprintf("%d tables", len(source.Tables))
+			}
+			if !opt.dryRun {
+				if err := CreatePublication(ctx, conn, source.AsProvider()); err != nil {
+					return err
+				}
+				step.Applied = true
+			}
+			plan.Steps = append(plan.Steps, step)
+			continue
+		}
+
+		if len(publication.Schemas) > 0 {
+			continue
+		}
+		if drift := publicationDrift(source, publication); len(drift) > 0 {
+			plan.Steps = append(plan.Steps, ReconcileStep{
+				Kind:   ReconcilePublication,
+				Name:   source.PublicationName,
+				Action: ReconcileDrift,
+				Detail: strings.Join(drift, "; "),
+			})
+		}
+	}
+
+	if len(opt.dropPublicationPrefix) == 0 {
+		return nil
+	}
+	for _, publication := range records {
+		if desired[publication.PublicationName] ||
+			len(publication.Schemas) > 0 ||
+			!strings.HasPrefix(publication.PublicationName, opt.dropPublicationPrefix) {
+			continue
+		}
+
+		step := ReconcileStep{
+			Kind:   ReconcilePublication,
+			Name:   publication.PublicationName,
+			Action: ReconcileDrop,
+		}
+		if !opt.dryRun {
+			if err := DropPublication(ctx, conn, publication.PublicationName); err != nil {
+				return err
+			}
+			step.Applied = true
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	return nil
+}
+
+func publicationDrift(source CreatePublicationSource, publication PublicationSource) []string {
+	var drift []string
+	if source.AllTables != publication.AllTables {
+		drift = append(drift, fmt.Sprintf("all tables is %v, want %v", publication.AllTables, source.AllTables))
+	}
+
+	var want = []string{"insert", "update", "delete", "truncate"}
+	if len(source.Publish) > 0 {
+		want = make([]string, len(source.Publish))
+		for i, op := range source.Publish {
+			want[i] = strings.ToLower(op)
+		}
+		sort.Strings(want)
+	}
+	have := publication.Publish()
+	sort.Strings(have)
+	if strings.Join(have, ",") != strings.Join(want, ",") {
+		drift = append(drift, fmt.Sprintf("publish is '%s', want '%s'", strings.Join(have, ", "), strings.Join(want, ", ")))
+	}
+
+	if source.AllTables || publication.AllTables {
+		return drift
+	}
+
+	var tables = make(map[string]bool, len(publication.Tables))
+	for _, t := range publication.Tables {
+		tables[t.Name] = true
+	}
+	var listed = make(map[string]bool, len(source.Tables))
+	for _, t := range source.Tables {
+		name := qualifyTableName(t.Name)
+		listed[name] = true
+		if !tables[name] {
+			drift = append(drift, fmt.Sprintf("table '%s' is missing", name))
+		}
+	}
+	for _, t := range publication.Tables {
+		if !listed[t.Name] {
+			drift = append(drift, fmt.Sprintf("table '%s' is not listed", t.Name))
+		}
+	}
+	return drift
+}
+
+// qualifyTableName returns name as "schema.table", defaulting the schema
+// to public, in the unquoted form ListPublications reports. Unquoted
+// identifiers are folded to lower case as PostgreSQL does.
+func qualifyTableName(name string) string {
+	var parts []string
+	for text := name + "."; len(text) > 0; {
+		ident, rest, err := scanIdentifier(text, ".")
+		if err != nil || !strings.HasPrefix(rest, ".") {
+			return name
+		}
+		if !strings.HasPrefix(text, `"`) {
+			ident = strings.ToLower(ident)
+		}
+		parts = append(parts, ident)
+		text = rest[1:]
+	}
+	if len(parts) == 1 {
+		return "public." + parts[0]
+	}
+	return strings.Join(parts, ".")
+}
+
+func describeSlot(slotType ReplicationMode, plugin string) string {
+	if slotType == LogicalReplication {
+		return fmt.Sprintf("logical, plugin '%s'", plugin)
+	}
+	return "physical"
+}
+
+func currentDatabase(ctx context.Context, conn *pgconn.PgConn) (string, error) {
+	results, err := conn.Exec(ctx, "SELECT current_database();").ReadAll()
+	if err != nil {
+		return "", err
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 {
+		return "", fmt.Errorf("unexpected result of current_database()")
+	}
+	return string(results[0].Rows[0][0]), nil
+}
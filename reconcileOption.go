@@ -0,0 +1,53 @@
+package postgres
+
+var _ ReconcileOption = reconcileOptionsFunc(nil)
+
+type ReconcileOption interface {
+	applyReconcileOptions(opt *reconcileOptions)
+}
+
+type reconcileOptions struct {
+	dryRun        bool
+	dropUnmanaged bool
+	publications  *CreatePublicationSourceProvider
+
+	dropPublicationPrefix string
+}
+
+type reconcileOptionsFunc func(opt *reconcileOptions)
+
+// applyReconcileOptions implements ReconcileOption.
+func (fn reconcileOptionsFunc) applyReconcileOptions(opt *reconcileOptions) {
+	fn(opt)
+}
+
+// /////////////////////////////////
+func WithReconcileDryRun() ReconcileOption {
+	return reconcileOptionsFunc(func(opt *reconcileOptions) {
+		opt.dryRun = true
+	})
+}
+
+// /////////////////////////////////
+func WithReconcileDropUnmanaged() ReconcileOption {
+	return reconcileOptionsFunc(func(opt *reconcileOptions) {
+		opt.dropUnmanaged = true
+	})
+}
+
+// /////////////////////////////////
+// WithReconcileDropPublications drops the publications that are not
+// listed with WithReconcilePublications and whose name starts with
+// prefix. An empty prefix drops nothing.
+func WithReconcileDropPublications(prefix string) ReconcileOption {
+	return reconcileOptionsFunc(func(opt *reconcileOptions) {
+		opt.dropPublicationPrefix = prefix
+	})
+}
+
+// /////////////////////////////////
+func WithReconcilePublications(provider CreatePublicationSourceProvider) ReconcileOption {
+	return reconcileOptionsFunc(func(opt *reconcileOptions) {
+		opt.publications = &provider
+	})
+}
@@ -0,0 +1,242 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func newStandInReconcileServer(t *testing.T, slots *standInSlots) *standInServer {
+	server := &standInServer{Handle: standInExec(func(query string) standInResult {
+		if strings.Contains(query, "current_database()") {
+			return standInResult{
+				Columns: []string{"current_database"},
+				Rows:    [][]string{{"postgres"}},
+			}
+		}
+		return slots.exec(query)
+	})}
+	server.start(t)
+	return server
+}
+
+func newReconcileSlots() *standInSlots {
+	return newStandInSlots(
+		ReplicationSlotSource{SlotName: "orders", Plugin: Wal2JsonPlugin, SlotType: LogicalReplication, Database: "postgres"},
+		ReplicationSlotSource{SlotName: "stale", Plugin: PgOutputPlugin, SlotType: LogicalReplication, Database: "postgres"},
+		ReplicationSlotSource{SlotName: "busy", Plugin: PgOutputPlugin, SlotType: LogicalReplication, Database: "postgres", Active: true},
+		ReplicationSlotSource{SlotName: "elsewhere", Plugin: PgOutputPlugin, SlotType: LogicalReplication, Database: "billing"},
+		ReplicationSlotSource{SlotName: "replica", SlotType: PhysicalReplication},
+	)
+}
+
+func newReconcileProvider() CreateReplicationSlotSourceProvider {
+	var provider CreateReplicationSlotSourceProvider
+	provider.AppendSource(CreateReplicationSlotSource{SlotName: "orders", Plugin: PgOutputPlugin, SlotType: LogicalReplication})
+	provider.AppendSource(CreateReplicationSlotSource{SlotName: "audit", Plugin: PgOutputPlugin, SlotType: LogicalReplication})
+	return provider
+}
+
+func TestReconcile_DryRun(t *testing.T) {
+	slots := newReconcileSlots()
+	conn := connectStandIn(t, newStandInReconcileServer(t, slots))
+
+	plan, err := Reconcile(context.Background(), conn, newReconcileProvider(),
+		WithReconcileDryRun(),
+		WithReconcileDropUnmanaged())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"~ slot orders: plugin is 'wal2json', want 'pgoutput'",
+		"+ slot audit: logical, plugin 'pgoutput'",
+		"- slot stale: logical, plugin 'pgoutput'",
+		"(dry run: nothing applied)",
+	}, "\n")
+	if plan.String() != expected {
+		t.Errorf("unexpected plan\n%s\nexpected\n%s", plan, expected)
+	}
+	if !plan.HasChanges() || len(plan.Drifted()) != 1 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	for _, q := range slots.Queries() {
+		if strings.HasPrefix(q, "CREATE_REPLICATION_SLOT") || strings.HasPrefix(q, "DROP_REPLICATION_SLOT") {
+			t.Errorf("unexpected query in dry run: %s", q)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	slots := newReconcileSlots()
+	conn := connectStandIn(t, newStandInReconcileServer(t, slots))
+
+	plan, err := Reconcile(context.Background(), conn, newReconcileProvider(), WithReconcileDropUnmanaged())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range plan.Steps {
+		if s.Applied != (s.Action != ReconcileDrift) {
+			t.Errorf("unexpected step %+v", s)
+		}
+	}
+
+	if s, ok := slots.Slot("audit"); !ok || s.Plugin != PgOutputPlugin {
+		t.Errorf("expected slot 'audit' to be created, got %+v", s)
+	}
+	if _, ok := slots.Slot("stale"); ok {
+		t.Error("expected slot 'stale' to be dropped")
+	}
+	for _, name := range []string{"orders", "busy", "elsewhere", "replica"} {
+		if _, ok := slots.Slot(name); !ok {
+			t.Errorf("expected slot '%s' to be kept", name)
+		}
+	}
+
+	for _, q := range slots.Queries() {
+		if strings.HasPrefix(q, "CREATE_REPLICATION_SLOT audit") && !strings.HasSuffix(q, " "+NoExportSnapshot) {
+			t.Errorf("expected no snapshot export, got '%s'", q)
+		}
+	}
+
+	// a second run only reports the drift
+	plan, err = Reconcile(context.Background(), conn, newReconcileProvider(), WithReconcileDropUnmanaged())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.HasChanges() || len(plan.Steps) != 1 {
+		t.Errorf("unexpected plan\n%s", plan)
+	}
+}
+
+func TestReconcile_Publications(t *testing.T) {
+	var queries []string
+	server := &standInServer{
+		ServerParams: map[string]string{"server_version": "15.4"},
+		Handle: standInExec(func(query string) standInResult {
+			queries = append(queries, query)
+			switch {
+			case strings.Contains(query, "current_database()"):
+				return standInResult{Columns: []string{"current_database"}, Rows: [][]string{{"postgres"}}}
+			case strings.Contains(query, `"pg_replication_slots"`):
+				return standInResult{Columns: []string{
+					"slot_name", "plugin", "slot_type", "database", "temporary", "active", "restart_lsn", "confirmed_flush_lsn",
+				}}
+			case strings.Contains(query, `FROM "pg_catalog"."pg_publication"`):
+				return standInResult{
+					Columns: []string{"pubname", "puballtables", "pubinsert", "pubupdate", "pubdelete", "pubtruncate"},
+					Rows: [][]string{
+						{"legacy", "t", "t", "t", "t", "t"},
+						{"app_legacy", "t", "t", "t", "t", "t"},
+						{"app_sales", "f", "t", "t", "t", "t"},
+						{"sales", "f", "t", "t", "t", "t"},
+						{"orders", "f", "t", "t", "f", "f"},
+					},
+				}
+			case strings.Contains(query, `"pg_publication_namespace"`):
+				return standInResult{
+					Columns: []string{"pubname", "nspname"},
+					Rows:    [][]string{{"app_sales", "sales"}, {"sales", "sales"}},
+				}
+			case strings.Contains(query, `"pg_publication_rel"`):
+				return standInResult{
+					Columns: []string{"pubname", "nspname", "relname", "attnames", "rowfilter"},
+					Rows:    [][]string{{"orders", "public", "orders", standInNull, standInNull}},
+				}
+			case strings.HasPrefix(query, "CREATE PUBLICATION"):
+				return standInResult{Tag: "CREATE PUBLICATION"}
+			case strings.HasPrefix(query, "DROP PUBLICATION"):
+				return standInResult{Tag: "DROP PUBLICATION"}
+			}
+			return standInResult{Error: "unexpected query " + query, ErrorCode: "42601"}
+		}),
+	}
+	server.start(t)
+
+	var publications CreatePublicationSourceProvider
+	publications.AppendSource(CreatePublicationSource{
+		PublicationName: "orders",
+		Tables:          []PublicationTable{{Name: "orders"}, {Name: `"public"."customers"`}},
+		Publish:         []string{"insert", "update"},
+	})
+	publications.AppendSource(CreatePublicationSource{PublicationName: "audit", AllTables: true})
+	// schema publications are left alone
+	publications.AppendSource(CreatePublicationSource{PublicationName: "sales", Tables: []PublicationTable{{Name: "sales.orders"}}})
+
+	conn := connectStandIn(t, server)
+
+	// dropping unmanaged slots leaves the publications alone
+	plan, err := Reconcile(context.Background(), conn,
+		CreateReplicationSlotSourceProvider{},
+		WithReconcilePublications(publications),
+		WithReconcileDropUnmanaged(),
+		WithReconcileDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range plan.Steps {
+		if s.Action == ReconcileDrop {
+			t.Errorf("unexpected step %+v", s)
+		}
+	}
+
+	plan, err = Reconcile(context.Background(), conn,
+		CreateReplicationSlotSourceProvider{},
+		WithReconcilePublications(publications),
+		WithReconcileDropPublications("app_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"~ publication orders: table 'public.customers' is missing",
+		"+ publication audit: all tables",
+		"- publication app_legacy",
+	}, "\n")
+	if plan.String() != expected {
+		t.Errorf("unexpected plan\n%s\nexpected\n%s", plan, expected)
+	}
+
+	var executed []string
+	for _, q := range queries {
+		if strings.HasPrefix(q, "CREATE PUBLICATION") || strings.HasPrefix(q, "DROP PUBLICATION") {
+			executed = append(executed, q)
+		}
+	}
+	if len(executed) != 2 ||
+		executed[0] != `CREATE PUBLICATION "audit" FOR ALL TABLES;` ||
+		!strings.Contains(executed[1], `"app_legacy"`) {
+		t.Errorf("unexpected statements %q", executed)
+	}
+}
+
+func TestQualifyTableName(t *testing.T) {
+	cases := map[string]string{
+		"orders":                "public.orders",
+		"sales.orders":          "sales.orders",
+		`"Sales"."Order ""A"""`: `Sales.Order "A"`,
+		`"public".orders`:       "public.orders",
+		`"unterminated`:         `"unterminated`,
+	}
+	for name, expected := range cases {
+		if v := qualifyTableName(name); v != expected {
+			t.Errorf("%s: expected '%s', got '%s'", name, expected, v)
+		}
+	}
+}
+
+func TestReconcile_TemporarySlot(t *testing.T) {
+	slots := newReconcileSlots()
+	conn := connectStandIn(t, newStandInReconcileServer(t, slots))
+
+	var provider CreateReplicationSlotSourceProvider
+	provider.AppendSource(CreateReplicationSlotSource{SlotName: "audit", Plugin: PgOutputPlugin, SlotType: LogicalReplication, Temporary: true})
+
+	if _, err := Reconcile(context.Background(), conn, provider); err == nil {
+		t.Fatal("expected error for a temporary slot")
+	}
+	if _, ok := slots.Slot("audit"); ok {
+		t.Error("expected no slot to be created")
+	}
+}
@@ -0,0 +1,14 @@
+package postgres
+
+var _ Event = ReconnectedEvent{}
+
+type ReconnectedEvent struct {
+	Slot     string
+	Attempt  int
+	StartLSN LSN
+}
+
+// ByteID implements Event.
+func (e ReconnectedEvent) ByteID() byte {
+	return ReconnectedEventByteID
+}
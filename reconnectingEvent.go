@@ -0,0 +1,19 @@
+package postgres
+
+import (
+	"time"
+)
+
+var _ Event = ReconnectingEvent{}
+
+type ReconnectingEvent struct {
+	Slot    string
+	Attempt int
+	Delay   time.Duration
+	Err     error
+}
+
+// ByteID implements Event.
+func (e ReconnectingEvent) ByteID() byte {
+	return ReconnectingEventByteID
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type RelationCache struct {
+	relations map[uint32]*RelationMessage
+	types     map[uint32]*TypeMessage
+	typeMap   *pgtype.Map
+
+	mutex sync.RWMutex
+}
+
+func NewRelationCache() *RelationCache {
+	return &RelationCache{
+		relations: make(map[uint32]*RelationMessage),
+		types:     make(map[uint32]*TypeMessage),
+	}
+}
+
+func (c *RelationCache) Relation(id uint32) (*RelationMessage, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	r, ok := c.relations[id]
+	return r, ok
+}
+
+func (c *RelationCache) Relations() []*RelationMessage {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var relations = make([]*RelationMessage, 0, len(c.relations))
+	for _, r := range c.relations {
+		relations = append(relations, r)
+	}
+	return relations
+}
+
+func (c *RelationCache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return len(c.relations)
+}
+
+func (c *RelationCache) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.relations = make(map[uint32]*RelationMessage)
+	c.types = make(map[uint32]*TypeMessage)
+}
+
+func (c *RelationCache) putRelation(r *RelationMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, col := range r.Columns {
+		r.Columns[i].TypeName = c.typeName(col.DataType)
+	}
+	c.relations[r.RelationID] = r
+}
+
+func (c *RelationCache) putType(t *TypeMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.types[t.DataType] = t
+}
+
+func (c *RelationCache) resolveTypeName(oid uint32) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.typeName(oid)
+}
+
+// typeName must be called with the mutex held.
+func (c *RelationCache) typeName(oid uint32) string {
+	if t, ok := c.types[oid]; ok {
+		return t.Name
+	}
+	if c.typeMap == nil {
+		c.typeMap = pgtype.NewMap()
+	}
+	if t, ok := c.typeMap.TypeForOID(oid); ok {
+		return t.Name
+	}
+	return ""
+}
@@ -1,6 +1,10 @@
 package postgres
 
-import "github.com/jackc/pglogrepl"
+import (
+	"strings"
+
+	"github.com/jackc/pglogrepl"
+)
 
 var _ ReplicationOption = StartReplicationOptionsFunc(nil)
 
@@ -18,9 +22,22 @@ func WithPluginArgs(args ...string) ReplicationOption {
 	})
 }
 
+// WithPluginArg adds the plugin argument to the ones set so far, quoting
+// name and value.
+func WithPluginArg(name, value string) ReplicationOption {
+	var arg = pluginArg(name, value)
+	return StartReplicationOptionsFunc(func(opt *pglogrepl.StartReplicationOptions) {
+		opt.PluginArgs = append(opt.PluginArgs, arg)
+	})
+}
+
 // /////////////////////////////////
 func WithReplicationMode(mode pglogrepl.ReplicationMode) ReplicationOption {
 	return StartReplicationOptionsFunc(func(opt *pglogrepl.StartReplicationOptions) {
 		opt.Mode = mode
 	})
 }
+
+func pluginArg(name, value string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `" '` + strings.ReplaceAll(value, `'`, `''`) + `'`
+}
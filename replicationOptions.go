@@ -9,3 +9,71 @@ func ConfigureReplicationOptions() ReplicationOptions {
 func (opt ReplicationOptions) WithPluginArgs(args ...string) ReplicationOptions {
 	return append(opt, WithPluginArgs(args...))
 }
+
+func (opt ReplicationOptions) WithPluginArg(name, value string) ReplicationOptions {
+	return append(opt, WithPluginArg(name, value))
+}
+
+func (opt ReplicationOptions) WithWal2JsonFormatVersion(version int) ReplicationOptions {
+	return append(opt, WithWal2JsonFormatVersion(version))
+}
+
+func (opt ReplicationOptions) WithWal2JsonIncludeXids(enabled bool) ReplicationOptions {
+	return append(opt, WithWal2JsonIncludeXids(enabled))
+}
+
+func (opt ReplicationOptions) WithWal2JsonIncludeTimestamp(enabled bool) ReplicationOptions {
+	return append(opt, WithWal2JsonIncludeTimestamp(enabled))
+}
+
+func (opt ReplicationOptions) WithWal2JsonIncludeLSN(enabled bool) ReplicationOptions {
+	return append(opt, WithWal2JsonIncludeLSN(enabled))
+}
+
+func (opt ReplicationOptions) WithWal2JsonIncludePK(enabled bool) ReplicationOptions {
+	return append(opt, WithWal2JsonIncludePK(enabled))
+}
+
+func (opt ReplicationOptions) WithWal2JsonIncludeTypes(enabled bool) ReplicationOptions {
+	return append(opt, WithWal2JsonIncludeTypes(enabled))
+}
+
+func (opt ReplicationOptions) WithWal2JsonIncludeTransaction(enabled bool) ReplicationOptions {
+	return append(opt, WithWal2JsonIncludeTransaction(enabled))
+}
+
+func (opt ReplicationOptions) WithWal2JsonPrettyPrint(enabled bool) ReplicationOptions {
+	return append(opt, WithWal2JsonPrettyPrint(enabled))
+}
+
+func (opt ReplicationOptions) WithWal2JsonAddTables(tables ...string) ReplicationOptions {
+	return append(opt, WithWal2JsonAddTables(tables...))
+}
+
+func (opt ReplicationOptions) WithWal2JsonFilterTables(tables ...string) ReplicationOptions {
+	return append(opt, WithWal2JsonFilterTables(tables...))
+}
+
+func (opt ReplicationOptions) WithWal2JsonActions(actions ...string) ReplicationOptions {
+	return append(opt, WithWal2JsonActions(actions...))
+}
+
+func (opt ReplicationOptions) WithWal2JsonAddMsgPrefixes(prefixes ...string) ReplicationOptions {
+	return append(opt, WithWal2JsonAddMsgPrefixes(prefixes...))
+}
+
+func (opt ReplicationOptions) WithWal2JsonFilterMsgPrefixes(prefixes ...string) ReplicationOptions {
+	return append(opt, WithWal2JsonFilterMsgPrefixes(prefixes...))
+}
+
+func (opt ReplicationOptions) WithTestDecodingIncludeXids(enabled bool) ReplicationOptions {
+	return append(opt, WithTestDecodingIncludeXids(enabled))
+}
+
+func (opt ReplicationOptions) WithTestDecodingIncludeTimestamp(enabled bool) ReplicationOptions {
+	return append(opt, WithTestDecodingIncludeTimestamp(enabled))
+}
+
+func (opt ReplicationOptions) WithTestDecodingSkipEmptyXacts(enabled bool) ReplicationOptions {
+	return append(opt, WithTestDecodingSkipEmptyXacts(enabled))
+}
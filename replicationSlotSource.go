@@ -13,5 +13,9 @@ type ReplicationSlotSource struct {
 	Active            bool
 	RestartLSN        pglogrepl.LSN
 	ConfirmedFlushLSN pglogrepl.LSN
-	startLSN          pglogrepl.LSN
+	// WALStatus is one of the WALStatus constants, or empty before
+	// PostgreSQL 13.
+	WALStatus string
+
+	startLSN pglogrepl.LSN
 }
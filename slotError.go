@@ -0,0 +1,22 @@
+package postgres
+
+import "fmt"
+
+// SlotError reports a slot that Subscribe cannot stream. Err is one of
+// the ErrSlot errors, or the error of creating a missing slot.
+type SlotError struct {
+	Slot   string
+	Detail string
+	Err    error
+}
+
+func (e *SlotError) Error() string {
+	if len(e.Detail) > 0 {
+		return fmt.Sprintf("cannot stream slot '%s': %v: %s", e.Slot, e.Err, e.Detail)
+	}
+	return fmt.Sprintf("cannot stream slot '%s': %v", e.Slot, e.Err)
+}
+
+func (e *SlotError) Unwrap() error {
+	return e.Err
+}
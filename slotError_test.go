@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newStandInSlotConsumer(t *testing.T, slots *standInSlots) *Consumer {
+	server := newStandInSlotServer(t, slots)
+	return &Consumer{
+		Config: &Config{
+			Host:                 server.Host,
+			Port:                 server.Port,
+			User:                 "postgres",
+			SSLMode:              "disable",
+			ReconnectMaxAttempts: -1,
+		},
+	}
+}
+
+func TestConsumer_SubscribeValidatesSlots(t *testing.T) {
+	slots := newStandInSlots(
+		ReplicationSlotSource{SlotName: "active", Plugin: PgOutputPlugin, SlotType: LogicalReplication, Database: "postgres", Active: true},
+		ReplicationSlotSource{SlotName: "lost", Plugin: PgOutputPlugin, SlotType: LogicalReplication, Database: "postgres", WALStatus: WALStatusLost},
+		ReplicationSlotSource{SlotName: "billing", Plugin: PgOutputPlugin, SlotType: LogicalReplication, Database: "billing"},
+		ReplicationSlotSource{SlotName: "replica", SlotType: PhysicalReplication},
+	)
+
+	cases := []struct {
+		slot     string
+		expected error
+	}{
+		{"missing", ErrSlotNotFound},
+		{"active", ErrSlotActive},
+		{"lost", ErrSlotInvalidated},
+		{"billing", ErrSlotDatabaseMismatch},
+		{"replica", ErrSlotTypeMismatch},
+	}
+	for _, c := range cases {
+		consumer := newStandInSlotConsumer(t, slots)
+		err := consumer.Subscribe(Slot(c.slot))
+
+		var slotErr *SlotError
+		if !errors.As(err, &slotErr) || slotErr.Slot != c.slot {
+			t.Errorf("%s: expected a SlotError, got %v", c.slot, err)
+			continue
+		}
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.slot, c.expected, err)
+		}
+	}
+
+	for _, q := range slots.Queries() {
+		if strings.HasPrefix(q, "START_REPLICATION") || strings.HasPrefix(q, "CREATE_REPLICATION_SLOT") {
+			t.Errorf("unexpected query %s", q)
+		}
+	}
+}
+
+func TestConsumer_SubscribeCreatesMissingSlot(t *testing.T) {
+	slots := newStandInSlots()
+	consumer := newStandInSlotConsumer(t, slots)
+	consumer.Config.CreateSlotIfMissing = &CreateReplicationSlotSource{
+		SlotName:       "ignored",
+		Plugin:         Wal2JsonPlugin,
+		SlotType:       LogicalReplication,
+		SnapshotAction: ExportSnapshot,
+	}
+
+	// the stand-in cannot stream; the slot is created before that
+	err := consumer.Subscribe(Slot("orders"))
+	if err == nil || !strings.Contains(err.Error(), "START_REPLICATION") {
+		t.Fatalf("expected START_REPLICATION to fail, got %v", err)
+	}
+
+	slot, ok := slots.Slot("orders")
+	if !ok || slot.Plugin != Wal2JsonPlugin || slot.SlotType != LogicalReplication {
+		t.Fatalf("unexpected slot %+v", slot)
+	}
+	if _, ok = slots.Slot("ignored"); ok {
+		t.Error("expected the template SlotName to be replaced")
+	}
+
+	var created bool
+	for _, q := range slots.Queries() {
+		if strings.HasPrefix(q, "CREATE_REPLICATION_SLOT") {
+			created = true
+			if !strings.Contains(q, NoExportSnapshot) {
+				t.Errorf("expected %s, got %s", NoExportSnapshot, q)
+			}
+		}
+	}
+	if !created {
+		t.Error("expected CREATE_REPLICATION_SLOT")
+	}
+}
+
+func TestConsumer_SubscribeCreateTemplateTypeMismatch(t *testing.T) {
+	slots := newStandInSlots()
+	consumer := newStandInSlotConsumer(t, slots)
+	consumer.Config.CreateSlotIfMissing = &CreateReplicationSlotSource{SlotType: PhysicalReplication}
+
+	err := consumer.Subscribe(Slot("orders"))
+	if !errors.Is(err, ErrSlotTypeMismatch) {
+		t.Fatalf("expected ErrSlotTypeMismatch, got %v", err)
+	}
+	if _, ok := slots.Slot("orders"); ok {
+		t.Error("expected no slot to be created")
+	}
+}
@@ -0,0 +1,15 @@
+package postgres
+
+var _ Event = SlotInvalidatedEvent{}
+
+// SlotInvalidatedEvent is emitted by a SlotMonitor once when the server
+// reports the wal_status of a slot as lost; the WAL the slot needs has
+// been removed and the slot can no longer stream.
+type SlotInvalidatedEvent struct {
+	SlotHealth
+}
+
+// ByteID implements Event.
+func (e SlotInvalidatedEvent) ByteID() byte {
+	return SlotInvalidatedEventByteID
+}
@@ -0,0 +1,17 @@
+package postgres
+
+var _ Event = SlotLagWarningEvent{}
+
+// SlotLagWarningEvent is emitted by a SlotMonitor when a slot crosses
+// one of its thresholds. It is emitted again only after the slot has
+// recovered below them.
+type SlotLagWarningEvent struct {
+	SlotHealth
+	LagThreshold         int64
+	SafeWALSizeThreshold int64
+}
+
+// ByteID implements Event.
+func (e SlotLagWarningEvent) ByteID() byte {
+	return SlotLagWarningEventByteID
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SlotManager manages the lifecycle of replication slots over a
+// replication connection such as the one returned by NewConn.
+type SlotManager struct {
+	conn *pgconn.PgConn
+}
+
+func NewSlotManager(conn *pgconn.PgConn) *SlotManager {
+	return &SlotManager{
+		conn: conn,
+	}
+}
+
+// ListReplicationSlots returns every replication slot of the server.
+func (m *SlotManager) ListReplicationSlots(ctx context.Context) ([]ReplicationSlotSource, error) {
+	sql := fmt.Sprintf(__SQL_LIST_REPLICATION_SLOTS, replicationSlotWALStatusColumn(m.conn))
+	return queryReplicationSlots(ctx, m.conn, sql)
+}
+
+// GetReplicationSlot returns the named slot; ok is false when it does
+// not exist.
+func (m *SlotManager) GetReplicationSlot(ctx context.Context, slot string) (source ReplicationSlotSource, ok bool, err error) {
+	records, err := SelectReplicationSlot(ctx, m.conn, []string{slot})
+	if err != nil {
+		return
+	}
+	for _, r := range records {
+		if r.SlotName == slot {
+			return r, true, nil
+		}
+	}
+	return
+}
+
+// DropReplicationSlot drops the slot. When wait is true and the slot is
+// active, the server waits for it to become inactive instead of failing.
+func (m *SlotManager) DropReplicationSlot(ctx context.Context, slot string, wait bool) error {
+	return pglogrepl.DropReplicationSlot(ctx, m.conn, slot, pglogrepl.DropReplicationSlotOptions{
+		Wait: wait,
+	})
+}
+
+// AdvanceReplicationSlot moves the slot forward to lsn with
+// pg_replication_slot_advance and returns the slot afterwards. The slot
+// must not be active.
+func (m *SlotManager) AdvanceReplicationSlot(ctx context.Context, slot string, lsn LSN) (ReplicationSlotSource, error) {
+	slotParam, err := m.conn.EscapeString(slot)
+	if err != nil {
+		return ReplicationSlotSource{}, err
+	}
+
+	sql := fmt.Sprintf(__SQL_ADVANCE_REPLICATION_SLOT,
+		"'"+slotParam+"'",
+		"'"+lsn.String()+"'::pg_lsn")
+	if _, err = m.conn.Exec(ctx, sql).ReadAll(); err != nil {
+		return ReplicationSlotSource{}, err
+	}
+
+	source, ok, err := m.GetReplicationSlot(ctx, slot)
+	if err != nil {
+		return ReplicationSlotSource{}, err
+	}
+	if !ok {
+		return ReplicationSlotSource{}, fmt.Errorf("replication slot '%s' does not exist", slot)
+	}
+	return source, nil
+}
+
+// EnsureReplicationSlot creates the slot described by source unless it
+// already exists, and returns the slot. created reports whether this
+// call created it. An existing slot with a different plugin or slot
+// type is an error.
+func (m *SlotManager) EnsureReplicationSlot(ctx context.Context, source CreateReplicationSlotSource) (slot ReplicationSlotSource, created bool, err error) {
+	_, err = createReplicationSlot(ctx, m.conn, source)
+	switch {
+	case err == nil:
+		created = true
+	case !IsDuplicateObjectError(err):
+		return
+	}
+
+	slot, ok, err := m.GetReplicationSlot(ctx, source.SlotName)
+	if err != nil {
+		return
+	}
+	if !ok {
+		return slot, created, fmt.Errorf("replication slot '%s' does not exist", source.SlotName)
+	}
+	if !created {
+		if slot.SlotType != source.SlotType {
+			return slot, false, fmt.Errorf("replication slot '%s' already exists as a %s slot",
+				source.SlotName, slot.SlotType)
+		}
+		if slot.SlotType == LogicalReplication && slot.Plugin != source.Plugin {
+			return slot, false, fmt.Errorf("replication slot '%s' already exists with plugin '%s'",
+				source.SlotName, slot.Plugin)
+		}
+	}
+	return slot, created, nil
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSlotManager_ListReplicationSlots(t *testing.T) {
+	slots := newStandInSlots(
+		ReplicationSlotSource{SlotName: "b", Plugin: PgOutputPlugin, SlotType: LogicalReplication, Database: "postgres", Active: true},
+		ReplicationSlotSource{SlotName: "a", SlotType: PhysicalReplication},
+	)
+	manager := NewSlotManager(connectStandIn(t, newStandInSlotServer(t, slots)))
+
+	records, err := manager.ListReplicationSlots(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 slots, got %+v", records)
+	}
+	if records[0].SlotName != "a" || records[0].SlotType != PhysicalReplication || len(records[0].Plugin) != 0 {
+		t.Errorf("unexpected slot %+v", records[0])
+	}
+	if records[1].SlotName != "b" || records[1].Plugin != PgOutputPlugin || !records[1].Active {
+		t.Errorf("unexpected slot %+v", records[1])
+	}
+}
+
+func TestSlotManager_EnsureReplicationSlot(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		slots   = newStandInSlots()
+		manager = NewSlotManager(connectStandIn(t, newStandInSlotServer(t, slots)))
+		source  = CreateReplicationSlotSource{
+			SlotName: "orders",
+			Plugin:   PgOutputPlugin,
+			SlotType: LogicalReplication,
+		}
+	)
+
+	slot, created, err := manager.EnsureReplicationSlot(ctx, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || slot.SlotName != "orders" || slot.Plugin != PgOutputPlugin {
+		t.Errorf("unexpected slot %+v (created %v)", slot, created)
+	}
+
+	slot, created, err = manager.EnsureReplicationSlot(ctx, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || slot.SlotName != "orders" {
+		t.Errorf("unexpected slot %+v (created %v)", slot, created)
+	}
+
+	source.Plugin = Wal2JsonPlugin
+	if _, _, err = manager.EnsureReplicationSlot(ctx, source); err == nil {
+		t.Error("expected error for a slot with a different plugin")
+	}
+}
+
+func TestSlotManager_AdvanceReplicationSlot(t *testing.T) {
+	slots := newStandInSlots(ReplicationSlotSource{
+		SlotName:          "orders",
+		Plugin:            PgOutputPlugin,
+		SlotType:          LogicalReplication,
+		Database:          "postgres",
+		ConfirmedFlushLSN: LSN(0x100),
+	})
+	manager := NewSlotManager(connectStandIn(t, newStandInSlotServer(t, slots)))
+
+	slot, err := manager.AdvanceReplicationSlot(context.Background(), "orders", LSN(0x2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.ConfirmedFlushLSN != LSN(0x2000) {
+		t.Errorf("expected confirmed flush %s, got %s", LSN(0x2000), slot.ConfirmedFlushLSN)
+	}
+
+	if _, err = manager.AdvanceReplicationSlot(context.Background(), "missing", LSN(0x2000)); err == nil {
+		t.Error("expected error for a missing slot")
+	}
+}
+
+func TestSlotManager_DropReplicationSlot(t *testing.T) {
+	slots := newStandInSlots(ReplicationSlotSource{SlotName: "orders", SlotType: PhysicalReplication})
+	manager := NewSlotManager(connectStandIn(t, newStandInSlotServer(t, slots)))
+
+	if err := manager.DropReplicationSlot(context.Background(), "orders", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := slots.Slot("orders"); ok {
+		t.Error("expected the slot to be dropped")
+	}
+	queries := slots.Queries()
+	if q := queries[len(queries)-1]; q != "DROP_REPLICATION_SLOT orders WAIT" {
+		t.Errorf("unexpected command '%s'", q)
+	}
+
+	if err := manager.DropReplicationSlot(context.Background(), "orders", false); err == nil {
+		t.Error("expected error for a missing slot")
+	}
+}
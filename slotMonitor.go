@@ -0,0 +1,313 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	WALStatusReserved   = "reserved"
+	WALStatusExtended   = "extended"
+	WALStatusUnreserved = "unreserved"
+	WALStatusLost       = "lost"
+)
+
+// slotMonitorErrorProc receives the error, or *PanicError, of the
+// EventHandler on a SlotMonitor event.
+type slotMonitorErrorProc func(event Event, err error)
+
+// SlotHealth is the state of a replication slot observed by a
+// SlotMonitor.
+type SlotHealth struct {
+	Slot     string
+	SlotType ReplicationMode
+	Active   bool
+	// WALStatus is one of the WALStatus constants, or empty before
+	// PostgreSQL 13.
+	WALStatus string
+	// SafeWALSize is the number of bytes that can still be written before
+	// the slot is in danger of losing WAL, or -1 when it is not limited
+	// by max_slot_wal_keep_size or unknown.
+	SafeWALSize       int64
+	RestartLSN        LSN
+	ConfirmedFlushLSN LSN
+	CurrentLSN        LSN
+	// RetainedBytes is the WAL the server keeps for the slot, from
+	// RestartLSN to CurrentLSN.
+	RetainedBytes int64
+	// LagBytes is the WAL the slot consumer has not confirmed yet, from
+	// ConfirmedFlushLSN, or RestartLSN for a physical slot, to CurrentLSN.
+	LagBytes int64
+}
+
+// Invalidated reports whether the slot has lost the WAL it needs.
+func (h SlotHealth) Invalidated() bool {
+	return h.WALStatus == WALStatusLost
+}
+
+// SlotMonitor periodically checks the replication slots over a regular
+// connection and emits a SlotLagWarningEvent when a slot crosses a
+// threshold and a SlotInvalidatedEvent when it is lost. Set it as
+// Consumer.SlotMonitor to watch the subscribed slots with the Consumer's
+// Config and EventHandler, or call Run to use it on its own.
+type SlotMonitor struct {
+	Config *Config
+	// Slots limits the monitor to the named slots; empty means every slot
+	// of the server, or the subscribed slots when run by a Consumer.
+	Slots    []string
+	Interval time.Duration // zero means DefaultSlotMonitorInterval
+	// LagThreshold is the LagBytes that triggers a SlotLagWarningEvent;
+	// zero means DefaultSlotLagThreshold and negative disables it.
+	LagThreshold int64
+	// SafeWALSizeThreshold triggers a SlotLagWarningEvent when the
+	// SafeWALSize of a slot falls to it; zero disables it. A slot whose
+	// WALStatus is unreserved always triggers one.
+	SafeWALSizeThreshold int64
+	EventHandler         EventHandleProc
+	Logger               *log.Logger
+
+	mutex       sync.Mutex
+	conn        *pgconn.PgConn
+	warned      map[string]bool
+	invalidated map[string]bool
+}
+
+// Run checks the slots every Interval until ctx is done. Errors and
+// panics of the EventHandler are logged.
+func (m *SlotMonitor) Run(ctx context.Context) error {
+	return m.run(ctx, m.Config, m.Slots, m.EventHandler, nil)
+}
+
+// Check queries the slots once, emits the events of the slots that
+// crossed a threshold since the last check and returns the state of
+// every monitored slot.
+func (m *SlotMonitor) Check(ctx context.Context) ([]SlotHealth, error) {
+	return m.check(ctx, m.Config, m.Slots, m.EventHandler, nil)
+}
+
+// Close closes the connection of the monitor.
+func (m *SlotMonitor) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.conn != nil {
+		m.conn.Close(context.Background())
+		m.conn = nil
+	}
+}
+
+func (m *SlotMonitor) run(ctx context.Context, config *Config, slots []string, handler EventHandleProc, report slotMonitorErrorProc) error {
+	defer m.Close()
+
+	var interval = m.Interval
+	if interval <= 0 {
+		interval = DefaultSlotMonitorInterval
+	}
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.check(ctx, config, slots, handler, report); err != nil && ctx.Err() == nil {
+			m.logger().Printf("SlotMonitor check failed: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// check emits the events after releasing the mutex, so the handler may
+// call Close or Check.
+func (m *SlotMonitor) check(ctx context.Context, config *Config, slots []string, handler EventHandleProc, report slotMonitorErrorProc) ([]SlotHealth, error) {
+	records, events, err := m.collect(ctx, config, slots)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range events {
+		if handler == nil {
+			m.logger().Printf("SlotMonitor:: %+v", e)
+			continue
+		}
+
+		var err error
+		if perr := protect(func() { err = handler(e) }); perr != nil {
+			err = perr
+		}
+		if err == nil {
+			continue
+		}
+		if report != nil {
+			report(e, err)
+		} else {
+			m.logger().Printf("SlotMonitor EventHandler failed on %+v: %+v", e, err)
+		}
+	}
+	return records, nil
+}
+
+// collect queries the slots and returns the events of the slots that
+// crossed a threshold since the last check.
+func (m *SlotMonitor) collect(ctx context.Context, config *Config, slots []string) ([]SlotHealth, []Event, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if config == nil {
+		return nil, nil, fmt.Errorf("the SlotMonitor requires a Config")
+	}
+	if m.conn == nil || m.conn.IsClosed() {
+		conn, err := newQueryConnContext(ctx, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		m.conn = conn
+	}
+
+	records, err := querySlotHealth(ctx, m.conn)
+	if err != nil {
+		// reconnect at the next check
+		m.conn.Close(context.Background())
+		m.conn = nil
+		return nil, nil, err
+	}
+
+	if len(slots) > 0 {
+		var names = make(map[string]bool, len(slots))
+		for _, s := range slots {
+			names[s] = true
+		}
+		var filtered = records[:0]
+		for _, r := range records {
+			if names[r.Slot] {
+				filtered = append(filtered, r)
+			}
+		}
+		records = filtered
+	}
+
+	if m.warned == nil {
+		m.warned = make(map[string]bool)
+		m.invalidated = make(map[string]bool)
+	}
+
+	var (
+		lagThreshold = m.lagThreshold()
+		seen         = make(map[string]bool, len(records))
+		events       []Event
+	)
+	for _, r := range records {
+		seen[r.Slot] = true
+
+		if r.Invalidated() {
+			if !m.invalidated[r.Slot] {
+				m.invalidated[r.Slot] = true
+				events = append(events, &SlotInvalidatedEvent{SlotHealth: r})
+			}
+			continue
+		}
+		delete(m.invalidated, r.Slot)
+
+		warning := (lagThreshold > 0 && r.LagBytes >= lagThreshold) ||
+			(m.SafeWALSizeThreshold > 0 && r.SafeWALSize >= 0 && r.SafeWALSize <= m.SafeWALSizeThreshold) ||
+			r.WALStatus == WALStatusUnreserved
+		if warning && !m.warned[r.Slot] {
+			events = append(events, &SlotLagWarningEvent{
+				SlotHealth:           r,
+				LagThreshold:         lagThreshold,
+				SafeWALSizeThreshold: m.SafeWALSizeThreshold,
+			})
+		}
+		m.warned[r.Slot] = warning
+	}
+
+	// forget the slots that have been dropped
+	for name := range m.warned {
+		if !seen[name] {
+			delete(m.warned, name)
+		}
+	}
+	for name := range m.invalidated {
+		if !seen[name] {
+			delete(m.invalidated, name)
+		}
+	}
+
+	return records, events, nil
+}
+
+func (m *SlotMonitor) lagThreshold() int64 {
+	if m.LagThreshold == 0 {
+		return DefaultSlotLagThreshold
+	}
+	return m.LagThreshold
+}
+
+func (m *SlotMonitor) logger() *log.Logger {
+	if m.Logger == nil {
+		return defaultLogger
+	}
+	return m.Logger
+}
+
+func querySlotHealth(ctx context.Context, conn *pgconn.PgConn) ([]SlotHealth, error) {
+	var columns = "wal_status, safe_wal_size"
+	if v := serverMajorVersion(conn); v > 0 && v < 13 {
+		columns = "NULL, NULL"
+	}
+
+	results, err := conn.Exec(ctx, fmt.Sprintf(__SQL_MONITOR_REPLICATION_SLOTS, columns)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []SlotHealth
+	for _, result := range results {
+		for _, v := range result.Rows {
+			r := SlotHealth{
+				Slot:        string(v[0]),
+				WALStatus:   string(v[3]),
+				SafeWALSize: -1,
+			}
+			{
+				t, err := ParseReplicationMode(string(v[1]))
+				if err != nil {
+					return nil, err
+				}
+				r.SlotType = t
+			}
+			r.Active = parsePgBool(v[2])
+			if v[4] != nil {
+				n, err := strconv.ParseInt(string(v[4]), 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				r.SafeWALSize = n
+			}
+			r.RestartLSN.Scan(string(v[5]))
+			r.ConfirmedFlushLSN.Scan(string(v[6]))
+			r.CurrentLSN.Scan(string(v[7]))
+
+			if r.RestartLSN > 0 && r.CurrentLSN > r.RestartLSN {
+				r.RetainedBytes = int64(r.CurrentLSN - r.RestartLSN)
+			}
+			var confirmed = r.ConfirmedFlushLSN
+			if r.SlotType == PhysicalReplication {
+				confirmed = r.RestartLSN
+			}
+			if confirmed > 0 && r.CurrentLSN > confirmed {
+				r.LagBytes = int64(r.CurrentLSN - confirmed)
+			}
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,255 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type standInSlotHealth struct {
+	mutex sync.Mutex
+	rows  [][]string
+}
+
+func (s *standInSlotHealth) set(rows ...[]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rows = rows
+}
+
+func (s *standInSlotHealth) exec(query string) standInResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !strings.Contains(query, `"pg_replication_slots"`) || !strings.Contains(query, "pg_current_wal_lsn") {
+		return standInResult{Error: "unexpected query " + query, ErrorCode: "42601"}
+	}
+	if !strings.Contains(query, "wal_status, safe_wal_size") {
+		return standInResult{Error: "expected wal_status", ErrorCode: "42601"}
+	}
+	return standInResult{
+		Columns: []string{"slot_name", "slot_type", "active", "wal_status", "safe_wal_size", "restart_lsn", "confirmed_flush_lsn", "current"},
+		Rows:    s.rows,
+	}
+}
+
+func TestSlotMonitor_Check(t *testing.T) {
+	var health standInSlotHealth
+	server := &standInServer{
+		ServerParams: map[string]string{"server_version": "16.2"},
+		Handle:       standInExec(health.exec),
+	}
+	server.start(t)
+
+	var events []Event
+	monitor := &SlotMonitor{
+		Config: &Config{
+			Host:    server.Host,
+			Port:    server.Port,
+			User:    "postgres",
+			SSLMode: "disable",
+		},
+		Slots:        []string{"orders", "audit", "replica"},
+		LagThreshold: 0x1000,
+		EventHandler: func(event Event) error {
+			events = append(events, event)
+			return nil
+		},
+	}
+	defer monitor.Close()
+
+	health.set(
+		[]string{"orders", "logical", "t", "reserved", standInNull, "0/1000", "0/1800", "0/3000"},
+		[]string{"audit", "logical", "f", "extended", "1024", "0/1000", "0/2F00", "0/3000"},
+		[]string{"replica", "physical", "t", "reserved", standInNull, "0/2000", standInNull, "0/3000"},
+		[]string{"other", "logical", "f", "lost", standInNull, "0/1000", "0/1000", "0/3000"},
+	)
+	records, err := monitor.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 slots, got %+v", records)
+	}
+	if r := records[0]; r.Slot != "orders" || r.LagBytes != 0x1800 || r.RetainedBytes != 0x2000 || r.SafeWALSize != -1 || !r.Active {
+		t.Errorf("unexpected health %+v", r)
+	}
+	if r := records[1]; r.LagBytes != 0x100 || r.SafeWALSize != 1024 {
+		t.Errorf("unexpected health %+v", r)
+	}
+	if r := records[2]; r.SlotType != PhysicalReplication || r.LagBytes != 0x1000 {
+		t.Errorf("unexpected health %+v", r)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if e, ok := events[0].(*SlotLagWarningEvent); !ok || e.Slot != "orders" || e.LagThreshold != 0x1000 {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+	if e, ok := events[1].(*SlotLagWarningEvent); !ok || e.Slot != "replica" {
+		t.Errorf("unexpected event %+v", events[1])
+	}
+
+	// warnings are not repeated while the slot stays behind
+	events = nil
+	health.set(
+		[]string{"orders", "logical", "t", "reserved", standInNull, "0/1000", "0/1800", "0/3100"},
+		[]string{"audit", "logical", "f", "lost", standInNull, "0/1000", "0/2F00", "0/3100"},
+	)
+	if _, err = monitor.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %+v", events)
+	}
+	if e, ok := events[0].(*SlotInvalidatedEvent); !ok || e.Slot != "audit" || !e.Invalidated() {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+
+	// a slot that recovered warns again when it falls behind again
+	events = nil
+	health.set([]string{"orders", "logical", "t", "reserved", standInNull, "0/3000", "0/3100", "0/3100"})
+	if _, err = monitor.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	health.set([]string{"orders", "logical", "t", "unreserved", "0", "0/3000", "0/3100", "0/3200"})
+	if _, err = monitor.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %+v", events)
+	}
+	if e, ok := events[0].(*SlotLagWarningEvent); !ok || e.WALStatus != WALStatusUnreserved {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
+
+func TestSlotMonitor_Run(t *testing.T) {
+	var health standInSlotHealth
+	health.set([]string{"orders", "logical", "f", "lost", standInNull, "0/1000", "0/1000", "0/3000"})
+	server := &standInServer{
+		ServerParams: map[string]string{"server_version": "16.2"},
+		Handle:       standInExec(health.exec),
+	}
+	server.start(t)
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan error)
+	)
+	monitor := &SlotMonitor{
+		Config: &Config{
+			Host:    server.Host,
+			Port:    server.Port,
+			User:    "postgres",
+			SSLMode: "disable",
+		},
+		EventHandler: func(event Event) error {
+			if _, ok := event.(*SlotInvalidatedEvent); ok {
+				cancel()
+			}
+			return nil
+		},
+	}
+	go func() { done <- monitor.Run(ctx) }()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if monitor.conn != nil {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestSlotMonitor_EventHandlerFailure(t *testing.T) {
+	var health standInSlotHealth
+	health.set(
+		[]string{"orders", "logical", "f", "lost", standInNull, "0/1000", "0/1000", "0/3000"},
+		[]string{"audit", "logical", "f", "lost", standInNull, "0/1000", "0/1000", "0/3000"},
+	)
+	server := &standInServer{
+		ServerParams: map[string]string{"server_version": "16.2"},
+		Handle:       standInExec(health.exec),
+	}
+	server.start(t)
+
+	var (
+		monitor *SlotMonitor
+		events  []Event
+	)
+	monitor = &SlotMonitor{
+		Config: &Config{
+			Host:    server.Host,
+			Port:    server.Port,
+			User:    "postgres",
+			SSLMode: "disable",
+		},
+		Logger: log.New(io.Discard, "", 0),
+		EventHandler: func(event Event) error {
+			events = append(events, event)
+			if len(events) == 1 {
+				// would deadlock if the events were emitted under the mutex
+				monitor.Close()
+				panic("boom")
+			}
+			return nil
+		},
+	}
+
+	records, err := monitor.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected 2 records, got %+v", records)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected the panic to be recovered and the next event emitted, got %+v", events)
+	}
+	if monitor.conn != nil {
+		t.Error("expected the connection to be closed by the handler")
+	}
+}
+
+func TestConsumer_SlotMonitorErrorHandler(t *testing.T) {
+	var health standInSlotHealth
+	health.set([]string{"orders", "logical", "f", "lost", standInNull, "0/1000", "0/1000", "0/3000"})
+	server := &standInServer{
+		ServerParams: map[string]string{"server_version": "16.2"},
+		Handle:       standInExec(health.exec),
+	}
+	server.start(t)
+
+	var (
+		c        = newTestConsumer(newStandInConfig(server))
+		failures []*ConsumerError
+		failed   = errors.New("handler failed")
+	)
+	c.ErrorHandler = func(err *ConsumerError) ErrorDecision {
+		failures = append(failures, err)
+		return ErrorStopConsumer
+	}
+	c.SlotMonitor = &SlotMonitor{
+		Slots: []string{"orders"},
+		EventHandler: func(event Event) error {
+			return failed
+		},
+	}
+	c.startSlotMonitor()
+	c.wg.Wait()
+
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 failure, got %+v", failures)
+	}
+	if f := failures[0]; f.Slot != "orders" || f.Phase != ErrorPhaseHandle || !errors.Is(f, failed) {
+		t.Errorf("unexpected failure %+v", f)
+	}
+	if cause := context.Cause(c.ctx); !errors.Is(cause, failed) {
+		t.Errorf("expected the Consumer to stop with the failure, got %v", cause)
+	}
+}
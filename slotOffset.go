@@ -5,6 +5,8 @@ var _ SlotOffsetInfo = SlotOffset{}
 type SlotOffset struct {
 	Slot string
 	LSN  string
+
+	snapshot *InitialSnapshot
 }
 
 // getSlotOffset implements SlotOffsetInfo.
@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"sync"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// SlotProgress holds the WAL positions reported to the server for a slot.
+type SlotProgress struct {
+	Received LSN // received from the walsender
+	Flushed  LSN // acknowledged by the handlers
+	Applied  LSN // delivered to and returned from the handlers
+}
+
+type slotProgressTracker struct {
+	progress SlotProgress
+	mutex    sync.RWMutex
+}
+
+func newSlotProgressTracker(lsn LSN) *slotProgressTracker {
+	return &slotProgressTracker{
+		progress: SlotProgress{
+			Received: lsn,
+			Flushed:  lsn,
+			Applied:  lsn,
+		},
+	}
+}
+
+func (t *slotProgressTracker) Progress() SlotProgress {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.progress
+}
+
+func (t *slotProgressTracker) receive(lsn LSN) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if lsn > t.progress.Received {
+		t.progress.Received = lsn
+	}
+}
+
+func (t *slotProgressTracker) apply(lsn LSN) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if lsn > t.progress.Applied {
+		t.progress.Applied = lsn
+	}
+}
+
+func (t *slotProgressTracker) flush(lsn LSN) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if lsn > t.progress.Flushed {
+		t.progress.Flushed = lsn
+	}
+}
+
+func (t *slotProgressTracker) standbyStatusUpdate() pglogrepl.StandbyStatusUpdate {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var p = t.progress
+	// never report more than has been received
+	if p.Flushed > p.Received {
+		p.Received = p.Flushed
+	}
+	if p.Applied > p.Received {
+		p.Received = p.Applied
+	}
+	return pglogrepl.StandbyStatusUpdate{
+		WALWritePosition: p.Received,
+		WALFlushPosition: p.Flushed,
+		WALApplyPosition: p.Applied,
+	}
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestSlotProgressTracker(t *testing.T) {
+	var tracker = newSlotProgressTracker(100)
+
+	tracker.receive(300)
+	tracker.apply(200)
+	tracker.flush(150)
+	tracker.flush(120) // never moves backwards
+
+	ssu := tracker.standbyStatusUpdate()
+	if ssu.WALWritePosition != 300 {
+		t.Errorf("expected write position 300, got %d", ssu.WALWritePosition)
+	}
+	if ssu.WALApplyPosition != 200 {
+		t.Errorf("expected apply position 200, got %d", ssu.WALApplyPosition)
+	}
+	if ssu.WALFlushPosition != 150 {
+		t.Errorf("expected flush position 150, got %d", ssu.WALFlushPosition)
+	}
+}
@@ -0,0 +1,19 @@
+package postgres
+
+var _ Event = SnapshotCompletedEvent{}
+
+// SnapshotCompletedEvent is emitted when the tables of an
+// InitialSnapshot have been delivered and the slot starts streaming
+// from ConsistentPoint.
+type SnapshotCompletedEvent struct {
+	Slot            string
+	SnapshotName    string
+	ConsistentPoint LSN
+	Tables          int
+	Rows            int
+}
+
+// ByteID implements Event.
+func (e SnapshotCompletedEvent) ByteID() byte {
+	return SnapshotCompletedEventByteID
+}
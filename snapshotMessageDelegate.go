@@ -0,0 +1,12 @@
+package postgres
+
+var _ MessageDelegate = new(snapshotMessageDelegate)
+
+// snapshotMessageDelegate acknowledges rows read by a snapshot. They have
+// no WAL position of their own, so there is nothing to confirm.
+type snapshotMessageDelegate struct{}
+
+// OnAck implements MessageDelegate.
+func (d *snapshotMessageDelegate) OnAck(msg *Message) {
+	msg.canAck()
+}
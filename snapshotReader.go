@@ -0,0 +1,232 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// snapshotReader reads tables on a regular connection inside a
+// REPEATABLE READ transaction.
+type snapshotReader struct {
+	conn      *pgconn.PgConn
+	relations *RelationCache
+	batchSize int
+
+	resolved map[*RelationMessage]bool
+}
+
+// begin starts the read-only transaction, importing snapshot when it
+// is not empty.
+func (r *snapshotReader) begin(ctx context.Context, snapshot string) error {
+	var sql = "BEGIN ISOLATION LEVEL REPEATABLE READ, READ ONLY;"
+	if len(snapshot) > 0 {
+		param, err := r.conn.EscapeString(snapshot)
+		if err != nil {
+			return err
+		}
+		sql += " SET TRANSACTION SNAPSHOT '" + param + "';"
+	}
+	_, err := r.conn.Exec(ctx, sql).ReadAll()
+	return err
+}
+
+func (r *snapshotReader) commit(ctx context.Context) error {
+	_, err := r.conn.Exec(ctx, "COMMIT;").ReadAll()
+	return err
+}
+
+func (r *snapshotReader) rollback(ctx context.Context) error {
+	_, err := r.conn.Exec(ctx, "ROLLBACK;").ReadAll()
+	return err
+}
+
+// relation resolves the table name the way PostgreSQL does, e.g.
+// "orders", "public.orders" or `"Order Lines"`, and fills in the primary
+// key. The columns are added by the first read.
+func (r *snapshotReader) relation(ctx context.Context, table string) (*RelationMessage, error) {
+	param, err := r.conn.EscapeString(table)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := r.conn.Exec(ctx, fmt.Sprintf(__SQL_SELECT_RELATION, "'"+param+"'")).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 {
+		return nil, fmt.Errorf("table '%s' does not exist", table)
+	}
+	row := results[0].Rows[0]
+	oid, err := strconv.ParseUint(string(row[0]), 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	relation := &RelationMessage{
+		RelationID:   uint32(oid),
+		Namespace:    string(row[1]),
+		RelationName: string(row[2]),
+	}
+
+	results, err = r.conn.Exec(ctx, fmt.Sprintf(__SQL_SELECT_PRIMARY_KEY, oid)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range results[0].Rows {
+		relation.Columns = append(relation.Columns, RelationColumn{
+			Name: string(row[0]),
+			Key:  true,
+		})
+	}
+	return relation, nil
+}
+
+// readTable reads every row of the relation and passes it to fn.
+func (r *snapshotReader) readTable(ctx context.Context, relation *RelationMessage, fn func(read *ReadMessage) error) (rows int, err error) {
+	return r.readQuery(ctx, relation,
+		"SELECT * FROM "+quoteIdentifier(relation.Namespace)+"."+quoteIdentifier(relation.RelationName),
+		fn)
+}
+
+// readChunk reads up to limit rows of relation whose primary key follows
+// the one of after, in primary key order. A nil after starts at the
+// first row.
+func (r *snapshotReader) readChunk(ctx context.Context, relation *RelationMessage, after Tuple, limit int, fn func(read *ReadMessage) error) (rows int, err error) {
+	var keys = relation.KeyColumns()
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("table '%s' has no primary key", relation.QualifiedName())
+	}
+
+	var columns = make([]string, len(keys))
+	for i, k := range keys {
+		columns[i] = quoteIdentifier(k)
+	}
+
+	var query = "SELECT * FROM " + quoteIdentifier(relation.Namespace) + "." + quoteIdentifier(relation.RelationName)
+	if after != nil {
+		var values = make([]string, len(keys))
+		for i, k := range keys {
+			col, ok := after.Get(k)
+			if !ok {
+				return 0, fmt.Errorf("row of '%s' lacks primary key column '%s'", relation.QualifiedName(), k)
+			}
+			param, err := r.conn.EscapeString(col.String())
+			if err != nil {
+				return 0, err
+			}
+			values[i] = "'" + param + "'"
+		}
+		query += " WHERE (" + strings.Join(columns, ", ") + ") > (" + strings.Join(values, ", ") + ")"
+	}
+	query += " ORDER BY " + strings.Join(columns, ", ") + " LIMIT " + strconv.Itoa(limit)
+
+	return r.readQuery(ctx, relation, query, fn)
+}
+
+// emitWatermark writes a non-transactional logical decoding message with
+// SnapshotWatermarkPrefix to the WAL.
+func (r *snapshotReader) emitWatermark(ctx context.Context, content string) error {
+	prefix, err := r.conn.EscapeString(SnapshotWatermarkPrefix)
+	if err != nil {
+		return err
+	}
+	param, err := r.conn.EscapeString(content)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.Exec(ctx, fmt.Sprintf(__SQL_EMIT_SNAPSHOT_WATERMARK, "'"+prefix+"'", "'"+param+"'")).ReadAll()
+	return err
+}
+
+// readQuery reads the rows of query, which must select from relation,
+// through a cursor in batches of batchSize rows.
+func (r *snapshotReader) readQuery(ctx context.Context, relation *RelationMessage, query string, fn func(read *ReadMessage) error) (rows int, err error) {
+	_, err = r.conn.Exec(ctx, "DECLARE "+__SNAPSHOT_CURSOR_NAME+" NO SCROLL CURSOR FOR "+query+";").ReadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	var fetch = "FETCH FORWARD " + strconv.Itoa(r.batchSize) + " FROM " + __SNAPSHOT_CURSOR_NAME + ";"
+	for {
+		results, err := r.conn.Exec(ctx, fetch).ReadAll()
+		if err != nil {
+			return rows, err
+		}
+		if len(results) != 1 || len(results[0].Rows) == 0 {
+			break
+		}
+
+		result := results[0]
+		if !r.resolved[relation] {
+			r.resolveColumns(relation, result.FieldDescriptions)
+		}
+		for _, values := range result.Rows {
+			read := &ReadMessage{
+				Relation: relation,
+				New:      r.tuple(relation, result.FieldDescriptions, values),
+			}
+			if err := fn(read); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+		if len(result.Rows) < r.batchSize {
+			break
+		}
+	}
+
+	_, err = r.conn.Exec(ctx, "CLOSE "+__SNAPSHOT_CURSOR_NAME+";").ReadAll()
+	return rows, err
+}
+
+// resolveColumns replaces relation.Columns with the fields of the first
+// fetched batch, keeping the key flags set by relation. The columns are
+// not touched afterwards, since delivered rows share the relation.
+func (r *snapshotReader) resolveColumns(relation *RelationMessage, fields []pgconn.FieldDescription) {
+	if r.resolved == nil {
+		r.resolved = make(map[*RelationMessage]bool)
+	}
+	r.resolved[relation] = true
+
+	var columns = make([]RelationColumn, len(fields))
+	for i, f := range fields {
+		columns[i] = RelationColumn{
+			Name:         f.Name,
+			DataType:     f.DataTypeOID,
+			TypeName:     r.relations.resolveTypeName(f.DataTypeOID),
+			TypeModifier: f.TypeModifier,
+		}
+		for _, c := range relation.Columns {
+			if c.Name == f.Name && c.Key {
+				columns[i].Key = true
+			}
+		}
+	}
+	relation.Columns = columns
+}
+
+func (r *snapshotReader) tuple(relation *RelationMessage, fields []pgconn.FieldDescription, values [][]byte) Tuple {
+	var tuple = make(Tuple, len(values))
+	for i, v := range values {
+		col := TupleColumn{
+			Kind: TupleDataTypeText,
+			Data: v,
+		}
+		if v == nil {
+			col.Kind = TupleDataTypeNull
+		}
+		if i < len(fields) {
+			col.Name = fields[i].Name
+			col.DataType = fields[i].DataTypeOID
+		}
+		if i < len(relation.Columns) {
+			col.TypeName = relation.Columns[i].TypeName
+		}
+		tuple[i] = col
+	}
+	return tuple
+}
@@ -0,0 +1,243 @@
+package postgres
+
+import (
+	"context"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// standInTable answers the queries snapshotReader sends for a single
+// table "public.orders" with primary key "id".
+type standInTable struct {
+	mutex   sync.Mutex
+	rows    [][]string
+	cursor  int
+	queries []string
+}
+
+func (s *standInTable) exec(query string) standInResult {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queries = append(s.queries, query)
+	switch {
+	case strings.HasPrefix(query, "BEGIN"):
+		return standInResult{Tag: "SET"}
+	case strings.Contains(query, `"pg_class"`):
+		return standInResult{
+			Columns: []string{"oid", "nspname", "relname"},
+			Rows:    [][]string{{"16384", "public", "orders"}},
+		}
+	case strings.Contains(query, `"pg_index"`):
+		return standInResult{
+			Columns: []string{"attname"},
+			Rows:    [][]string{{"id"}},
+		}
+	case strings.HasPrefix(query, "DECLARE "):
+		s.cursor = 0
+		return standInResult{Tag: "DECLARE CURSOR"}
+	case strings.HasPrefix(query, "FETCH FORWARD "):
+		n, _ := strconv.Atoi(strings.Fields(query)[2])
+		end := s.cursor + n
+		if end > len(s.rows) {
+			end = len(s.rows)
+		}
+		rows := s.rows[s.cursor:end]
+		s.cursor = end
+		return standInResult{Columns: []string{"id", "name"}, Rows: rows}
+	case strings.HasPrefix(query, "CLOSE "):
+		return standInResult{Tag: "CLOSE CURSOR"}
+	case strings.HasPrefix(query, "COMMIT"), strings.HasPrefix(query, "ROLLBACK"):
+		return standInResult{Tag: "COMMIT"}
+	}
+	return standInResult{Error: "unexpected query " + query, ErrorCode: "42601"}
+}
+
+func TestSnapshotReader(t *testing.T) {
+	table := &standInTable{rows: [][]string{
+		{"1", "a"},
+		{"2", standInNull},
+		{"3", "c"},
+	}}
+	server := &standInServer{Handle: standInExec(table.exec)}
+	server.start(t)
+
+	ctx := context.Background()
+	conn, err := newQueryConnContext(ctx, &Config{
+		Host:    server.Host,
+		Port:    server.Port,
+		User:    "postgres",
+		SSLMode: "disable",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	if _, ok := server.Startups()[0].Parameters["replication"]; ok {
+		t.Error("expected a regular connection")
+	}
+
+	reader := &snapshotReader{
+		conn:      conn,
+		relations: NewRelationCache(),
+		batchSize: 2,
+	}
+	if err := reader.begin(ctx, "00000003-00000002-1"); err != nil {
+		t.Fatal(err)
+	}
+	relation, err := reader.relation(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reads []*ReadMessage
+	rows, err := reader.readTable(ctx, relation, func(read *ReadMessage) error {
+		reads = append(reads, read)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows != 3 || len(reads) != 3 {
+		t.Fatalf("expected 3 rows, got %d", rows)
+	}
+	if name := reads[0].Relation.QualifiedName(); name != "public.orders" {
+		t.Errorf("expected relation 'public.orders', got '%s'", name)
+	}
+	if keys := reads[0].Relation.KeyColumns(); len(keys) != 1 || keys[0] != "id" {
+		t.Errorf("expected key columns [id], got %v", keys)
+	}
+	if col, ok := reads[0].New.Get("name"); !ok || col.String() != "a" || col.TypeName != "text" {
+		t.Errorf("unexpected column 'name': %+v", col)
+	}
+	if col, _ := reads[1].New.Get("name"); !col.IsNull() {
+		t.Errorf("expected NULL, got %+v", col)
+	}
+
+	if q := table.queries[0]; !strings.Contains(q, "SET TRANSACTION SNAPSHOT '00000003-00000002-1'") {
+		t.Errorf("expected the snapshot to be imported, got '%s'", q)
+	}
+	if q := table.queries[3]; !strings.Contains(q, `SELECT * FROM "public"."orders"`) {
+		t.Errorf("unexpected cursor query '%s'", q)
+	}
+}
+
+func TestConsumer_InitialSnapshot(t *testing.T) {
+	table := &standInTable{rows: [][]string{{"1", "a"}, {"2", "b"}}}
+	replication := newStandInReplication()
+	replication.Exec = table.exec
+	server := newStandInReplicationServer(t, replication)
+
+	var (
+		mutex     sync.Mutex
+		rows      []string
+		completed = make(chan *SnapshotCompletedEvent, 2)
+	)
+	consumer := &Consumer{
+		MessageHandler: func(msg *Message) {
+			msgs, err := msg.Decode()
+			if err != nil || !msg.IsSnapshot() {
+				t.Errorf("unexpected snapshot message %+v: %v", msg, err)
+				return
+			}
+			read := msgs[0].(*ReadMessage)
+			col, _ := read.New.Get("id")
+
+			mutex.Lock()
+			rows = append(rows, col.String())
+			mutex.Unlock()
+		},
+		EventHandler: func(event Event) error {
+			if e, ok := event.(*SnapshotCompletedEvent); ok {
+				completed <- e
+			}
+			return nil
+		},
+		Logger: log.New(io.Discard, "", 0),
+		Config: newStandInConfig(server),
+	}
+	err := consumer.Subscribe(InitialSnapshot{
+		Slot:   "orders",
+		Plugin: "test_decoding",
+		Tables: []string{"orders"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	stream := replication.Stream(t)
+	mutex.Lock()
+	if strings.Join(rows, ",") != "1,2" {
+		t.Errorf("expected the rows before streaming, got %q", rows)
+	}
+	mutex.Unlock()
+	if stream.Slot != "orders" || stream.StartLSN != LSN(0x1000000) {
+		t.Errorf("expected streaming at the consistent point, got '%s'", stream.Query)
+	}
+	if s, ok := replication.Slot("orders"); !ok || s.Temporary {
+		t.Errorf("expected a persistent slot, got %+v", s)
+	}
+	replication.WaitSlots(t, "orders")
+
+	select {
+	case e := <-completed:
+		if e.Slot != "orders" || e.ConsistentPoint != LSN(0x1000000) || e.Rows != 2 {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the SnapshotCompletedEvent")
+	}
+	consumer.Close()
+	if n := len(completed); n != 0 {
+		t.Errorf("expected a single SnapshotCompletedEvent, got %d more", n)
+	}
+}
+
+func TestConsumer_InitialSnapshotFailureLeavesNoSlot(t *testing.T) {
+	replication := newStandInReplication()
+	server := newStandInReplicationServer(t, replication)
+
+	consumer := &Consumer{
+		MessageHandler: func(msg *Message) {},
+		Logger:         log.New(io.Discard, "", 0),
+		Config:         newStandInConfig(server),
+	}
+	err := consumer.Subscribe(InitialSnapshot{
+		Slot:   "orders",
+		Plugin: "test_decoding",
+		Tables: []string{"orders"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	select {
+	case <-consumer.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the Consumer to stop")
+	}
+	if consumer.Err() == nil {
+		t.Error("expected the snapshot error")
+	}
+	var created bool
+	for _, q := range replication.Queries() {
+		created = created || strings.HasPrefix(q, "CREATE_REPLICATION_SLOT orders_snapshot_load TEMPORARY")
+	}
+	if !created {
+		t.Errorf("expected a temporary slot, got %q", replication.Queries())
+	}
+	// the temporary slot goes with the connection
+	replication.WaitSlots(t)
+}
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SourceFieldError reports an invalid entry of a source file, such as a
+// replication slot read by CreateReplicationSlotSourceProvider.ScanYAML.
+type SourceFieldError struct {
+	Entry int    // zero-based position of the entry in the file
+	Name  string // the name of the entry, when it has one
+	Field string // empty when the entry as a whole is invalid
+	Line  int    // zero when unknown
+	Err   error
+}
+
+func (e *SourceFieldError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "entry #%d", e.Entry+1)
+	if len(e.Name) > 0 {
+		fmt.Fprintf(&sb, " '%s'", e.Name)
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, " (line %d)", e.Line)
+	}
+	if len(e.Field) > 0 {
+		fmt.Fprintf(&sb, ": field '%s'", e.Field)
+	}
+	fmt.Fprintf(&sb, ": %v", e.Err)
+	return sb.String()
+}
+
+func (e *SourceFieldError) Unwrap() error {
+	return e.Err
+}
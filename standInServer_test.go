@@ -0,0 +1,726 @@
+package postgres
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// standInServer speaks just enough of the PostgreSQL protocol to let
+// pgconn complete a startup handshake.
+type standInServer struct {
+	Host string
+	Port uint16
+
+	TLSConfig  *tls.Config
+	RequireTLS bool
+	// ServerParams are sent as ParameterStatus messages after the
+	// authentication.
+	ServerParams map[string]string
+	// Handle serves the queries after the startup; it may be nil.
+	Handle func(backend *pgproto3.Backend, msg pgproto3.FrontendMessage) bool
+	// Closed is called when a connection served by Handle ends.
+	Closed func(backend *pgproto3.Backend)
+
+	listener net.Listener
+	mutex    sync.Mutex
+	startups []standInStartup
+}
+
+type standInStartup struct {
+	TLS        bool
+	Parameters map[string]string
+}
+
+func (s *standInServer) start(t *testing.T) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.listener = ln
+	s.Host = "127.0.0.1"
+	s.Port = uint16(ln.Addr().(*net.TCPAddr).Port)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+}
+
+func (s *standInServer) Startups() []standInStartup {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]standInStartup(nil), s.startups...)
+}
+
+func (s *standInServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var (
+		backend = pgproto3.NewBackend(conn, conn)
+		secure  bool
+	)
+	for {
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.SSLRequest:
+			if s.TLSConfig == nil {
+				conn.Write([]byte("N"))
+				continue
+			}
+			conn.Write([]byte("S"))
+			tlsConn := tls.Server(conn, s.TLSConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			backend = pgproto3.NewBackend(conn, conn)
+			secure = true
+		case *pgproto3.GSSEncRequest:
+			conn.Write([]byte("N"))
+		case *pgproto3.StartupMessage:
+			s.mutex.Lock()
+			s.startups = append(s.startups, standInStartup{
+				TLS:        secure,
+				Parameters: msg.Parameters,
+			})
+			s.mutex.Unlock()
+
+			if s.RequireTLS && !secure {
+				backend.Send(&pgproto3.ErrorResponse{
+					Severity: "FATAL",
+					Code:     "28000",
+					Message:  "TLS is required",
+				})
+				backend.Flush()
+				return
+			}
+
+			backend.Send(&pgproto3.AuthenticationOk{})
+			backend.Send(&pgproto3.ParameterStatus{Name: "client_encoding", Value: "UTF8"})
+			backend.Send(&pgproto3.ParameterStatus{Name: "standard_conforming_strings", Value: "on"})
+			for k, v := range s.ServerParams {
+				backend.Send(&pgproto3.ParameterStatus{Name: k, Value: v})
+			}
+			backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if err := backend.Flush(); err != nil {
+				return
+			}
+			s.loop(backend)
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (s *standInServer) loop(backend *pgproto3.Backend) {
+	if s.Closed != nil {
+		defer s.Closed(backend)
+	}
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		if _, ok := msg.(*pgproto3.Terminate); ok {
+			return
+		}
+		if s.Handle == nil || !s.Handle(backend, msg) {
+			return
+		}
+	}
+}
+
+// newStandInCertificate creates a self-signed CA and a server
+// certificate for 127.0.0.1 and localhost. It returns the server
+// certificate and the path of the CA PEM file.
+func newStandInCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "stand-in CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "root.crt")
+	err = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, caFile
+}
+
+// standInResult is the answer of standInExec to a simple query. A
+// non-empty Error is sent as an ErrorResponse with code ErrorCode.
+type standInResult struct {
+	Columns   []string
+	Rows      [][]string
+	Tag       string
+	Error     string
+	ErrorCode string
+}
+
+// standInExec answers every simple query with the result of fn.
+func standInExec(fn func(query string) standInResult) func(*pgproto3.Backend, pgproto3.FrontendMessage) bool {
+	return func(backend *pgproto3.Backend, msg pgproto3.FrontendMessage) bool {
+		query, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return false
+		}
+
+		result := fn(query.String)
+		if len(result.Error) > 0 {
+			backend.Send(&pgproto3.ErrorResponse{
+				Severity: "ERROR",
+				Code:     result.ErrorCode,
+				Message:  result.Error,
+			})
+		} else {
+			if len(result.Columns) > 0 {
+				fields := make([]pgproto3.FieldDescription, len(result.Columns))
+				for i, name := range result.Columns {
+					fields[i] = pgproto3.FieldDescription{Name: []byte(name), DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1}
+				}
+				backend.Send(&pgproto3.RowDescription{Fields: fields})
+			}
+			for _, row := range result.Rows {
+				values := make([][]byte, len(row))
+				for i, v := range row {
+					if v != standInNull {
+						values[i] = []byte(v)
+					}
+				}
+				backend.Send(&pgproto3.DataRow{Values: values})
+			}
+			tag := result.Tag
+			if len(tag) == 0 {
+				tag = "SELECT " + strconv.Itoa(len(result.Rows))
+			}
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+		}
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		return backend.Flush() == nil
+	}
+}
+
+// standInNull marks a NULL value in standInResult.Rows.
+const standInNull = "\x00null"
+
+// standInQueries answers simple queries with the single value mapped to
+// the query text.
+func standInQueries(values map[string]string) func(*pgproto3.Backend, pgproto3.FrontendMessage) bool {
+	return standInExec(func(query string) standInResult {
+		value, ok := values[query]
+		if !ok {
+			return standInResult{Error: "unexpected query " + query, ErrorCode: "42601"}
+		}
+		return standInResult{
+			Columns: []string{"value"},
+			Rows:    [][]string{{value}},
+		}
+	})
+}
+
+func newStandInNode(t *testing.T, name string, standby bool) *standInServer {
+	var recovery, readOnly = "f", "off"
+	if standby {
+		recovery, readOnly = "t", "on"
+	}
+
+	server := &standInServer{
+		ServerParams: map[string]string{"stand_in_name": name},
+		Handle: standInQueries(map[string]string{
+			"SELECT pg_is_in_recovery()": recovery,
+			"SHOW transaction_read_only": readOnly,
+		}),
+	}
+	server.start(t)
+	return server
+}
+
+// standInSlots is an in-memory pg_replication_slots behind the
+// replication commands and queries the package sends.
+type standInSlots struct {
+	mutex   sync.Mutex
+	slots   map[string]ReplicationSlotSource
+	queries []string
+}
+
+func newStandInSlots(slots ...ReplicationSlotSource) *standInSlots {
+	c := &standInSlots{slots: make(map[string]ReplicationSlotSource)}
+	for _, s := range slots {
+		c.slots[s.SlotName] = s
+	}
+	return c
+}
+
+func (c *standInSlots) Queries() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]string(nil), c.queries...)
+}
+
+func (c *standInSlots) Slot(name string) (ReplicationSlotSource, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	s, ok := c.slots[name]
+	return s, ok
+}
+
+func (c *standInSlots) exec(query string) standInResult {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.queries = append(c.queries, query)
+
+	var fields = strings.Fields(query)
+	switch {
+	case strings.HasPrefix(query, "IDENTIFY_SYSTEM"):
+		return standInResult{
+			Columns: []string{"systemid", "timeline", "xlogpos", "dbname"},
+			Rows:    [][]string{{"7000000000000000001", "1", "0/2000000", "postgres"}},
+		}
+	case strings.HasPrefix(query, "CREATE_REPLICATION_SLOT "):
+		name := fields[1]
+		if _, ok := c.slots[name]; ok {
+			return standInResult{
+				Error:     "replication slot \"" + name + "\" already exists",
+				ErrorCode: __PG_ERRCODE_DUPLICATE_OBJECT,
+			}
+		}
+		var (
+			slot = ReplicationSlotSource{SlotName: name, Database: "postgres"}
+			rest = fields[2:]
+		)
+		if len(rest) > 0 && rest[0] == "TEMPORARY" {
+			slot.Temporary = true
+			rest = rest[1:]
+		}
+		slot.SlotType, _ = ParseReplicationMode(rest[0])
+		if slot.SlotType == LogicalReplication {
+			slot.Plugin = rest[1]
+		}
+		slot.RestartLSN = LSN(0x1000000)
+		slot.ConfirmedFlushLSN = LSN(0x1000000)
+		c.slots[name] = slot
+		return standInResult{
+			Columns: []string{"slot_name", "consistent_point", "snapshot_name", "output_plugin"},
+			Rows:    [][]string{{name, slot.ConfirmedFlushLSN.String(), "00000003-00000002-1", slot.Plugin}},
+			Tag:     "CREATE_REPLICATION_SLOT",
+		}
+	case strings.HasPrefix(query, "DROP_REPLICATION_SLOT "):
+		name := fields[1]
+		if _, ok := c.slots[name]; !ok {
+			return standInResult{
+				Error:     "replication slot \"" + name + "\" does not exist",
+				ErrorCode: "42704",
+			}
+		}
+		delete(c.slots, name)
+		return standInResult{Tag: "DROP_REPLICATION_SLOT"}
+	case strings.Contains(query, "pg_copy_logical_replication_slot"):
+		args := strings.Split(query[strings.Index(query, "(")+1:strings.LastIndex(query, ")")], ",")
+		src := strings.Trim(strings.TrimSpace(args[0]), "'")
+		dst := strings.Trim(strings.TrimSpace(args[1]), "'")
+		slot, ok := c.slots[src]
+		if !ok {
+			return standInResult{Error: "replication slot \"" + src + "\" does not exist", ErrorCode: "42704"}
+		}
+		if _, ok := c.slots[dst]; ok {
+			return standInResult{
+				Error:     "replication slot \"" + dst + "\" already exists",
+				ErrorCode: __PG_ERRCODE_DUPLICATE_OBJECT,
+			}
+		}
+		slot.SlotName = dst
+		slot.Temporary = false
+		c.slots[dst] = slot
+		return standInResult{
+			Columns: []string{"slot_name"},
+			Rows:    [][]string{{dst}},
+		}
+	case strings.Contains(query, "pg_replication_slot_advance"):
+		args := strings.Split(query[strings.Index(query, "(")+1:strings.LastIndex(query, ")")], ",")
+		name := strings.Trim(strings.TrimSpace(args[0]), "'")
+		lsn, _ := pglogrepl.ParseLSN(strings.TrimSuffix(strings.Trim(strings.TrimSpace(args[1]), "'"), "'::pg_lsn"))
+		slot, ok := c.slots[name]
+		if !ok {
+			return standInResult{Error: "replication slot \"" + name + "\" does not exist", ErrorCode: "42704"}
+		}
+		if lsn > slot.ConfirmedFlushLSN {
+			slot.ConfirmedFlushLSN = lsn
+			c.slots[name] = slot
+		}
+		return standInResult{
+			Columns: []string{"end_lsn"},
+			Rows:    [][]string{{slot.ConfirmedFlushLSN.String()}},
+		}
+	case strings.Contains(query, `"pg_replication_slots"`):
+		var names []string
+		for name := range c.slots {
+			if !strings.Contains(query, "WHERE slot_name IN") || strings.Contains(query, "'"+name+"'") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		result := standInResult{Columns: []string{
+			"slot_name", "plugin", "slot_type", "database", "temporary", "active", "restart_lsn", "confirmed_flush_lsn",
+		}}
+		walStatus := strings.Contains(query, "wal_status")
+		if walStatus {
+			result.Columns = append(result.Columns, "wal_status")
+		}
+		for _, name := range names {
+			s := c.slots[name]
+			var plugin, database, flush = s.Plugin, s.Database, s.ConfirmedFlushLSN.String()
+			if s.SlotType == PhysicalReplication {
+				plugin, database, flush = standInNull, standInNull, standInNull
+			}
+			row := []string{
+				s.SlotName,
+				plugin,
+				strings.ToLower(s.SlotType.String()),
+				database,
+				strconv.FormatBool(s.Temporary),
+				strconv.FormatBool(s.Active),
+				s.RestartLSN.String(),
+				flush,
+			}
+			if walStatus {
+				status := s.WALStatus
+				if len(status) == 0 {
+					status = WALStatusReserved
+				}
+				row = append(row, status)
+			}
+			result.Rows = append(result.Rows, row)
+		}
+		return result
+	}
+	return standInResult{Error: "unexpected query " + query, ErrorCode: "42601"}
+}
+
+func newStandInSlotServer(t *testing.T, slots *standInSlots) *standInServer {
+	server := &standInServer{Handle: standInExec(slots.exec)}
+	server.start(t)
+	return server
+}
+
+// newStandInConfig returns a Config connecting to server.
+func newStandInConfig(server *standInServer) *Config {
+	return &Config{
+		Host:           server.Host,
+		Port:           server.Port,
+		User:           "postgres",
+		SSLMode:        "disable",
+		PollingTimeout: 50 * time.Millisecond,
+	}
+}
+
+func connectStandIn(t *testing.T, server *standInServer) *pgconn.PgConn {
+	t.Helper()
+
+	conn, err := NewConn(newStandInConfig(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	return conn
+}
+
+// standInReplication serves replication connections: standInSlots
+// answers the commands and queries, and START_REPLICATION opens a
+// standInStream the test writes the WAL to. Temporary slots are dropped
+// with the connection that created them.
+type standInReplication struct {
+	*standInSlots
+	// Exec answers the queries standInSlots does not know; it may be nil.
+	Exec func(query string) standInResult
+
+	mutex     sync.Mutex
+	streams   map[*pgproto3.Backend]*standInStream
+	temporary map[*pgproto3.Backend][]string
+	started   chan *standInStream
+}
+
+func newStandInReplication(slots ...ReplicationSlotSource) *standInReplication {
+	return &standInReplication{
+		standInSlots: newStandInSlots(slots...),
+		streams:      make(map[*pgproto3.Backend]*standInStream),
+		temporary:    make(map[*pgproto3.Backend][]string),
+		started:      make(chan *standInStream, 16),
+	}
+}
+
+func newStandInReplicationServer(t *testing.T, replication *standInReplication) *standInServer {
+	server := &standInServer{
+		Handle: replication.handle,
+		Closed: replication.closed,
+	}
+	server.start(t)
+	return server
+}
+
+// WaitSlots waits until the server has exactly the named slots.
+func (r *standInReplication) WaitSlots(t *testing.T, names ...string) {
+	t.Helper()
+
+	var (
+		deadline = time.Now().Add(5 * time.Second)
+		actual   []string
+	)
+	sort.Strings(names)
+	for time.Now().Before(deadline) {
+		r.standInSlots.mutex.Lock()
+		actual = actual[:0]
+		for name := range r.slots {
+			actual = append(actual, name)
+		}
+		r.standInSlots.mutex.Unlock()
+
+		sort.Strings(actual)
+		if strings.Join(actual, ",") == strings.Join(names, ",") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected slots %q, got %q", names, actual)
+}
+
+func (r *standInReplication) exec(backend *pgproto3.Backend) func(query string) standInResult {
+	return func(query string) standInResult {
+		result := r.standInSlots.exec(query)
+		if r.Exec != nil && strings.HasPrefix(result.Error, "unexpected query") {
+			return r.Exec(query)
+		}
+
+		var fields = strings.Fields(query)
+		if len(result.Error) == 0 && len(fields) > 2 &&
+			fields[0] == "CREATE_REPLICATION_SLOT" && fields[2] == "TEMPORARY" {
+			r.mutex.Lock()
+			r.temporary[backend] = append(r.temporary[backend], fields[1])
+			r.mutex.Unlock()
+		}
+		return result
+	}
+}
+
+func (r *standInReplication) closed(backend *pgproto3.Backend) {
+	r.mutex.Lock()
+	names := r.temporary[backend]
+	delete(r.temporary, backend)
+	r.mutex.Unlock()
+
+	r.standInSlots.mutex.Lock()
+	defer r.standInSlots.mutex.Unlock()
+
+	for _, name := range names {
+		if s, ok := r.slots[name]; ok && s.Temporary {
+			delete(r.slots, name)
+		}
+	}
+}
+
+// Stream waits for the next START_REPLICATION.
+func (r *standInReplication) Stream(t *testing.T) *standInStream {
+	t.Helper()
+
+	select {
+	case s := <-r.started:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for START_REPLICATION")
+		return nil
+	}
+}
+
+func (r *standInReplication) handle(backend *pgproto3.Backend, msg pgproto3.FrontendMessage) bool {
+	r.mutex.Lock()
+	stream := r.streams[backend]
+	r.mutex.Unlock()
+
+	switch msg := msg.(type) {
+	case *pgproto3.Query:
+		if !strings.HasPrefix(msg.String, "START_REPLICATION ") {
+			return standInExec(r.exec(backend))(backend, msg)
+		}
+		fields := strings.Fields(msg.String)
+		lsn, err := pglogrepl.ParseLSN(fields[4])
+		if err != nil {
+			return false
+		}
+		stream = &standInStream{
+			Slot:     fields[2],
+			StartLSN: lsn,
+			Query:    msg.String,
+			backend:  backend,
+		}
+		r.mutex.Lock()
+		r.streams[backend] = stream
+		r.mutex.Unlock()
+
+		stream.mutex.Lock()
+		backend.Send(&pgproto3.CopyBothResponse{})
+		err = backend.Flush()
+		stream.mutex.Unlock()
+		if err != nil {
+			return false
+		}
+		r.started <- stream
+		return true
+	case *pgproto3.CopyData:
+		if stream == nil {
+			return false
+		}
+		stream.receive(msg.Data)
+		return true
+	}
+	return false
+}
+
+// standInStream is the CopyBoth stream of a START_REPLICATION.
+type standInStream struct {
+	Slot     string
+	StartLSN LSN
+	Query    string
+
+	backend *pgproto3.Backend
+	mutex   sync.Mutex
+	flushed []LSN
+}
+
+// Send streams the XLogData or keepalive frames.
+func (s *standInStream) Send(frames ...[]byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, frame := range frames {
+		s.backend.Send(&pgproto3.CopyData{Data: frame})
+	}
+	return s.backend.Flush()
+}
+
+// Fail ends the stream with an ErrorResponse.
+func (s *standInStream) Fail(message string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.backend.Send(&pgproto3.ErrorResponse{
+		Severity: "ERROR",
+		Code:     "57P01",
+		Message:  message,
+	})
+	return s.backend.Flush()
+}
+
+// Flushed returns the flush positions of the standby status updates
+// received so far.
+func (s *standInStream) Flushed() []LSN {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]LSN(nil), s.flushed...)
+}
+
+// WaitFlushed waits for a standby status update confirming lsn.
+func (s *standInStream) WaitFlushed(t *testing.T, lsn LSN) {
+	t.Helper()
+
+	var deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if flushed := s.Flushed(); len(flushed) > 0 && flushed[len(flushed)-1] >= lsn {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for slot '%s' to flush %s, got %v", s.Slot, lsn, s.Flushed())
+}
+
+func (s *standInStream) receive(data []byte) {
+	if len(data) < 34 || data[0] != pglogrepl.StandbyStatusUpdateByteID {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.flushed = append(s.flushed, LSN(binary.BigEndian.Uint64(data[9:17])))
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jackc/pgservicefile"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TargetSessionAttrs selects which server NewConn accepts when Config
+// lists several hosts. The values follow libpq target_session_attrs.
+type TargetSessionAttrs string
+
+const (
+	TargetSessionAttrsAny       TargetSessionAttrs = "any"
+	TargetSessionAttrsReadWrite TargetSessionAttrs = "read-write"
+	TargetSessionAttrsReadOnly  TargetSessionAttrs = "read-only"
+	TargetSessionAttrsPrimary   TargetSessionAttrs = "primary"
+	TargetSessionAttrsStandby   TargetSessionAttrs = "standby"
+	// TargetSessionAttrsPreferStandby picks a standby when one is
+	// reachable. Otherwise the hosts are tried again without any check
+	// and the first server that accepts the connection is taken, whatever
+	// its role.
+	TargetSessionAttrsPreferStandby TargetSessionAttrs = "prefer-standby"
+)
+
+func ParseTargetSessionAttrs(s string) (TargetSessionAttrs, error) {
+	switch a := TargetSessionAttrs(strings.ToLower(s)); a {
+	case "":
+		return TargetSessionAttrsAny, nil
+	case TargetSessionAttrsAny,
+		TargetSessionAttrsReadWrite,
+		TargetSessionAttrsReadOnly,
+		TargetSessionAttrsPrimary,
+		TargetSessionAttrsStandby,
+		TargetSessionAttrsPreferStandby:
+		return a, nil
+	}
+	return "", fmt.Errorf("unsupported target session attrs '%s'", s)
+}
+
+// lookupTargetSessionAttrs returns the target_session_attrs that applies
+// to connString with the precedence of pgconn.ParseConfig: the
+// connection string, then its service, then PGTARGETSESSIONATTRS.
+func lookupTargetSessionAttrs(connString string) (TargetSessionAttrs, error) {
+	settings, err := connStringSettings(connString)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := settings["target_session_attrs"]; ok {
+		return TargetSessionAttrs(v), nil
+	}
+
+	var service = settings["service"]
+	if len(service) == 0 {
+		service = os.Getenv("PGSERVICE")
+	}
+	if len(service) > 0 {
+		var path = settings["servicefile"]
+		if len(path) == 0 {
+			path = os.Getenv("PGSERVICEFILE")
+		}
+		if len(path) == 0 {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, ".pg_service.conf")
+			}
+		}
+		file, err := pgservicefile.ReadServicefile(path)
+		if err != nil {
+			return "", fmt.Errorf("read service file '%s': %w", path, err)
+		}
+		s, err := file.GetService(service)
+		if err != nil {
+			return "", err
+		}
+		if v, ok := s.Settings["target_session_attrs"]; ok {
+			return TargetSessionAttrs(v), nil
+		}
+	}
+	return TargetSessionAttrs(os.Getenv("PGTARGETSESSIONATTRS")), nil
+}
+
+// validateConnect returns the check run against every candidate host.
+// The checks use the simple query protocol because a walsender
+// connection rejects the extended one that pgconn's own validators use.
+// prefer-standby checks for a standby; NewConnContext falls back to any
+// host when none is found.
+func (a TargetSessionAttrs) validateConnect() pgconn.ValidateConnectFunc {
+	switch a {
+	case TargetSessionAttrsReadWrite:
+		return validateConnectSetting("SHOW transaction_read_only", "off", "read only connection")
+	case TargetSessionAttrsReadOnly:
+		return validateConnectSetting("SHOW transaction_read_only", "on", "connection is not read only")
+	case TargetSessionAttrsPrimary:
+		return validateConnectSetting("SELECT pg_is_in_recovery()", "f", "server is in standby mode")
+	case TargetSessionAttrsStandby, TargetSessionAttrsPreferStandby:
+		return validateConnectSetting("SELECT pg_is_in_recovery()", "t", "server is not in hot standby mode")
+	}
+	return nil
+}
+
+func validateConnectSetting(query, expected, reason string) pgconn.ValidateConnectFunc {
+	return func(ctx context.Context, conn *pgconn.PgConn) error {
+		results, err := conn.Exec(ctx, query).ReadAll()
+		if err != nil {
+			return err
+		}
+		if len(results) != 1 || len(results[0].Rows) != 1 || len(results[0].Rows[0]) != 1 {
+			return fmt.Errorf("unexpected result of '%s'", query)
+		}
+		if string(results[0].Rows[0][0]) != expected {
+			return fmt.Errorf("%s", reason)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,322 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ MessageDecoder = new(TestDecodingDecoder)
+
+const (
+	__TEST_DECODING_NO_TUPLE_DATA   = "(no-tuple-data)"
+	__TEST_DECODING_UNCHANGED_TOAST = "unchanged-toast-datum"
+	__TEST_DECODING_NULL            = "null"
+)
+
+// TestDecodingDecoder parses the text output of the test_decoding
+// plugin.
+type TestDecodingDecoder struct{}
+
+// Decode implements MessageDecoder.
+func (d *TestDecodingDecoder) Decode(relations *RelationCache, data []byte) ([]LogicalMessage, error) {
+	var line = strings.TrimSpace(string(data))
+
+	var msg LogicalMessage
+	switch {
+	case line == "BEGIN" || strings.HasPrefix(line, "BEGIN "):
+		begin := new(BeginMessage)
+		if rest := strings.TrimSpace(strings.TrimPrefix(line, "BEGIN")); len(rest) > 0 {
+			xid, err := strconv.ParseUint(rest, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid test_decoding BEGIN '%s': %w", line, err)
+			}
+			begin.Xid = uint32(xid)
+		}
+		msg = begin
+	case line == "COMMIT" || strings.HasPrefix(line, "COMMIT "):
+		commit := new(CommitMessage)
+		rest := strings.TrimSpace(strings.TrimPrefix(line, "COMMIT"))
+		if i := strings.Index(rest, "(at "); i >= 0 && strings.HasSuffix(rest, ")") {
+			ts, err := parseTestDecodingTimestamp(rest[i+4 : len(rest)-1])
+			if err != nil {
+				return nil, err
+			}
+			commit.CommitTime = ts
+		}
+		msg = commit
+	case strings.HasPrefix(line, "table "):
+		m, err := d.decodeChange(line)
+		if err != nil {
+			return nil, err
+		}
+		msg = m
+	case strings.HasPrefix(line, "message: "):
+		m, err := d.decodeMessage(line)
+		if err != nil {
+			return nil, err
+		}
+		msg = m
+	default:
+		return nil, fmt.Errorf("unsupported test_decoding line '%s'", line)
+	}
+	return []LogicalMessage{msg}, nil
+}
+
+func (d *TestDecodingDecoder) decodeChange(line string) (LogicalMessage, error) {
+	// table <name>[, <name>...]: <ACTION>: <data>
+	var rest = strings.TrimPrefix(line, "table ")
+
+	relations, rest, err := scanTestDecodingRelations(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid test_decoding change '%s': %w", line, err)
+	}
+
+	i := strings.Index(rest, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid test_decoding change '%s': missing action", line)
+	}
+	action, rest := rest[:i], strings.TrimSpace(rest[i+1:])
+
+	switch action {
+	case "INSERT":
+		tuple, err := d.decodeTuple(relations[0], rest)
+		if err != nil {
+			return nil, err
+		}
+		return &InsertMessage{Relation: relations[0], New: tuple}, nil
+	case "UPDATE":
+		var oldPart, newPart = "", rest
+		if strings.HasPrefix(rest, "old-key: ") {
+			i := strings.Index(rest, " new-tuple: ")
+			if i < 0 {
+				return nil, fmt.Errorf("invalid test_decoding change '%s': missing new-tuple", line)
+			}
+			oldPart, newPart = rest[len("old-key: "):i], rest[i+len(" new-tuple: "):]
+		}
+		newPart = strings.TrimPrefix(newPart, "new-tuple: ")
+
+		oldTuple, err := d.decodeTuple(relations[0], oldPart)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range oldTuple {
+			markTestDecodingKey(relations[0], c.Name)
+		}
+		newTuple, err := d.decodeTuple(relations[0], newPart)
+		if err != nil {
+			return nil, err
+		}
+		return &UpdateMessage{Relation: relations[0], Old: oldTuple, New: newTuple}, nil
+	case "DELETE":
+		oldTuple, err := d.decodeTuple(relations[0], rest)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range oldTuple {
+			markTestDecodingKey(relations[0], c.Name)
+		}
+		return &DeleteMessage{Relation: relations[0], Old: oldTuple}, nil
+	case "TRUNCATE":
+		m := &TruncateMessage{Relations: relations}
+		for _, flag := range strings.Fields(rest) {
+			switch flag {
+			case "cascade":
+				m.Cascade = true
+			case "restart_seqs":
+				m.RestartIdentity = true
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported test_decoding action '%s'", action)
+}
+
+func (d *TestDecodingDecoder) decodeTuple(relation *RelationMessage, text string) (Tuple, error) {
+	text = strings.TrimSpace(text)
+	if len(text) == 0 || text == __TEST_DECODING_NO_TUPLE_DATA {
+		return nil, nil
+	}
+
+	var tuple Tuple
+	for len(text) > 0 {
+		name, rest, err := scanIdentifier(text, "[")
+		if err != nil {
+			return nil, err
+		}
+		typeName, rest, err := scanTestDecodingTypeName(rest)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %w", name, err)
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return nil, fmt.Errorf("column '%s': missing value", name)
+		}
+		col, rest, err := scanTestDecodingValue(rest[1:])
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %w", name, err)
+		}
+		col.Name = name
+		col.TypeName = typeName
+		tuple = append(tuple, col)
+
+		addTestDecodingColumn(relation, name, typeName)
+		text = strings.TrimLeft(rest, " ")
+	}
+	return tuple, nil
+}
+
+func (d *TestDecodingDecoder) decodeMessage(line string) (LogicalMessage, error) {
+	// message: transactional: 1 prefix: <prefix>, sz: <n> content:<content>
+	var m = new(LogicalDecodingMessage)
+
+	rest := strings.TrimPrefix(line, "message: transactional: ")
+	if len(rest) == 0 {
+		return nil, fmt.Errorf("invalid test_decoding message '%s'", line)
+	}
+	m.Transactional = rest[0] == '1'
+
+	i := strings.Index(rest, " prefix: ")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid test_decoding message '%s': missing prefix", line)
+	}
+	rest = rest[i+len(" prefix: "):]
+
+	i = strings.Index(rest, ", sz: ")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid test_decoding message '%s': missing size", line)
+	}
+	m.Prefix, rest = rest[:i], rest[i+len(", sz: "):]
+
+	i = strings.Index(rest, " content:")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid test_decoding message '%s': missing content", line)
+	}
+	size, err := strconv.Atoi(rest[:i])
+	if err != nil {
+		return nil, fmt.Errorf("invalid test_decoding message '%s': %w", line, err)
+	}
+	content := rest[i+len(" content:"):]
+	if len(content) > size {
+		content = content[:size]
+	}
+	m.Content = []byte(content)
+	return m, nil
+}
+
+func addTestDecodingColumn(relation *RelationMessage, name, typeName string) {
+	for _, c := range relation.Columns {
+		if c.Name == name {
+			return
+		}
+	}
+	relation.Columns = append(relation.Columns, RelationColumn{
+		Name:     name,
+		TypeName: typeName,
+	})
+}
+
+func markTestDecodingKey(relation *RelationMessage, name string) {
+	for i := range relation.Columns {
+		if relation.Columns[i].Name == name {
+			relation.Columns[i].Key = true
+		}
+	}
+}
+
+func scanTestDecodingRelations(text string) (relations []*RelationMessage, rest string, err error) {
+	rest = text
+	for {
+		var (
+			schema string
+			name   string
+		)
+		schema, rest, err = scanIdentifier(rest, ".")
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ".") {
+			return nil, "", fmt.Errorf("relation name '%s' is not schema-qualified", schema)
+		}
+		name, rest, err = scanIdentifier(rest[1:], ",:")
+		if err != nil {
+			return nil, "", err
+		}
+		relations = append(relations, &RelationMessage{
+			Namespace:    schema,
+			RelationName: name,
+		})
+
+		switch {
+		case strings.HasPrefix(rest, ", "):
+			rest = rest[2:]
+		case strings.HasPrefix(rest, ": "):
+			return relations, rest[2:], nil
+		default:
+			return nil, "", fmt.Errorf("unexpected text '%s'", rest)
+		}
+	}
+}
+
+func scanTestDecodingTypeName(text string) (typeName, rest string, err error) {
+	if !strings.HasPrefix(text, "[") {
+		return "", "", fmt.Errorf("missing type name")
+	}
+
+	var depth int
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return text[1:i], text[i+1:], nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("unterminated type name '%s'", text)
+}
+
+func scanTestDecodingValue(text string) (col TupleColumn, rest string, err error) {
+	col.Kind = TupleDataTypeText
+
+	if strings.HasPrefix(text, "'") {
+		var sb strings.Builder
+		for i := 1; i < len(text); i++ {
+			if text[i] == '\'' {
+				if i+1 < len(text) && text[i+1] == '\'' {
+					sb.WriteByte('\'')
+					i++
+					continue
+				}
+				col.Data = []byte(sb.String())
+				return col, text[i+1:], nil
+			}
+			sb.WriteByte(text[i])
+		}
+		return col, "", fmt.Errorf("unterminated quoted value '%s'", text)
+	}
+
+	var value = text
+	if i := strings.IndexByte(text, ' '); i >= 0 {
+		value, rest = text[:i], text[i:]
+	}
+	switch value {
+	case __TEST_DECODING_NULL:
+		col.Kind = TupleDataTypeNull
+	case __TEST_DECODING_UNCHANGED_TOAST:
+		col.Kind = TupleDataTypeToast
+	default:
+		col.Data = []byte(value)
+	}
+	return col, rest, nil
+}
+
+func parseTestDecodingTimestamp(s string) (time.Time, error) {
+	ts, err := parseTimestamptz(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid test_decoding timestamp '%s'", s)
+	}
+	return ts, nil
+}
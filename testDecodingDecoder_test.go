@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestTestDecodingDecoder(t *testing.T) {
+	var (
+		decoder = new(TestDecodingDecoder)
+		lines   = []string{
+			`BEGIN 529`,
+			`table public.foo: INSERT: id[integer]:1 name[text]:'it''s x' tags[text[]]:'{a,b}' note[character varying]:null`,
+			`table public."Foo Bar": UPDATE: old-key: id[integer]:1 new-tuple: id[integer]:2 data[text]:unchanged-toast-datum`,
+			`table public.foo: DELETE: id[integer]:2`,
+			`table public.foo, public.bar: TRUNCATE: cascade`,
+			`message: transactional: 0 prefix: wm, sz: 5 content:hello`,
+			`COMMIT 529 (at 2024-05-06 07:08:09.123456+00)`,
+		}
+		decoded []LogicalMessage
+	)
+	for _, line := range lines {
+		msgs, err := decoder.Decode(nil, []byte(line))
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		decoded = append(decoded, msgs...)
+	}
+
+	if begin := decoded[0].(*BeginMessage); begin.Xid != 529 {
+		t.Errorf("expected xid 529, got %d", begin.Xid)
+	}
+
+	insert := decoded[1].(*InsertMessage)
+	if insert.Relation.QualifiedName() != "public.foo" {
+		t.Errorf("expected relation 'public.foo', got '%s'", insert.Relation.QualifiedName())
+	}
+	if len(insert.New) != 4 {
+		t.Fatalf("expected 4 columns, got %d", len(insert.New))
+	}
+	if col, _ := insert.New.Get("name"); col.String() != "it's x" {
+		t.Errorf("expected name \"it's x\", got '%s'", col.String())
+	}
+	if col, _ := insert.New.Get("tags"); col.TypeName != "text[]" || col.String() != "{a,b}" {
+		t.Errorf("unexpected column 'tags': %+v", col)
+	}
+	if col, _ := insert.New.Get("note"); !col.IsNull() || col.TypeName != "character varying" {
+		t.Errorf("unexpected column 'note': %+v", col)
+	}
+
+	update := decoded[2].(*UpdateMessage)
+	if update.Relation.RelationName != "Foo Bar" {
+		t.Errorf("expected relation 'Foo Bar', got '%s'", update.Relation.RelationName)
+	}
+	if keys := update.Relation.KeyColumns(); len(keys) != 1 || keys[0] != "id" {
+		t.Errorf("expected key columns [id], got %v", keys)
+	}
+	if col, _ := update.New.Get("data"); !col.IsUnchangedToast() {
+		t.Errorf("expected unchanged toast, got %+v", col)
+	}
+
+	if del := decoded[3].(*DeleteMessage); len(del.Old) != 1 {
+		t.Errorf("expected 1 old column, got %d", len(del.Old))
+	}
+
+	truncate := decoded[4].(*TruncateMessage)
+	if len(truncate.Relations) != 2 || !truncate.Cascade || truncate.RestartIdentity {
+		t.Errorf("unexpected truncate: %+v", truncate)
+	}
+
+	message := decoded[5].(*LogicalDecodingMessage)
+	if message.Transactional || message.Prefix != "wm" || string(message.Content) != "hello" {
+		t.Errorf("unexpected message: %+v", message)
+	}
+
+	if commit := decoded[6].(*CommitMessage); commit.CommitTime.IsZero() {
+		t.Errorf("expected commit timestamp")
+	}
+}
@@ -0,0 +1,20 @@
+package postgres
+
+import (
+	"strconv"
+)
+
+// /////////////////////////////////
+func WithTestDecodingIncludeXids(enabled bool) ReplicationOption {
+	return WithPluginArg("include-xids", strconv.FormatBool(enabled))
+}
+
+// /////////////////////////////////
+func WithTestDecodingIncludeTimestamp(enabled bool) ReplicationOption {
+	return WithPluginArg("include-timestamp", strconv.FormatBool(enabled))
+}
+
+// /////////////////////////////////
+func WithTestDecodingSkipEmptyXacts(enabled bool) ReplicationOption {
+	return WithPluginArg("skip-empty-xacts", strconv.FormatBool(enabled))
+}
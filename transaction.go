@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	gob.Register(new(BeginMessage))
+	gob.Register(new(CommitMessage))
+	gob.Register(new(OriginMessage))
+	gob.Register(new(RelationMessage))
+	gob.Register(new(TypeMessage))
+	gob.Register(new(InsertMessage))
+	gob.Register(new(UpdateMessage))
+	gob.Register(new(DeleteMessage))
+	gob.Register(new(TruncateMessage))
+	gob.Register(new(LogicalDecodingMessage))
+	gob.Register(new(ReadMessage))
+}
+
+type Transaction struct {
+	Slot       string
+	Delegate   TransactionDelegate
+	Xid        uint32
+	FinalLSN   LSN
+	CommitLSN  LSN
+	EndLSN     LSN
+	CommitTime time.Time
+	Origin     string
+
+	consumedXLogPos LSN
+	ackEntry        *ackEntry
+	database        string
+	systemID        string
+
+	changes []LogicalMessage
+	count   int
+
+	spill        *os.File
+	spillWriter  *bufio.Writer
+	spillEncoder *gob.Encoder
+	spilled      int
+
+	responded int32
+}
+
+type spilledChange struct {
+	Change LogicalMessage
+}
+
+func (tx *Transaction) SystemID() string {
+	return tx.systemID
+}
+
+func (tx *Transaction) Database() string {
+	return tx.database
+}
+
+// Len returns the number of changes in the transaction.
+func (tx *Transaction) Len() int {
+	return tx.count
+}
+
+// Spilled reports whether part of the transaction was written to disk.
+func (tx *Transaction) Spilled() bool {
+	return tx.spilled > 0
+}
+
+// Range calls fn for every change in commit order. Spilled changes are
+// only readable while the TransactionHandler is running.
+func (tx *Transaction) Range(fn func(change LogicalMessage) error) error {
+	if tx.spilled > 0 {
+		if tx.spill == nil {
+			return fmt.Errorf("spilled changes of transaction %d have been released", tx.Xid)
+		}
+		if err := tx.spillWriter.Flush(); err != nil {
+			return err
+		}
+		if _, err := tx.spill.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		var decoder = gob.NewDecoder(bufio.NewReader(tx.spill))
+		for i := 0; i < tx.spilled; i++ {
+			var v spilledChange
+			if err := decoder.Decode(&v); err != nil {
+				return err
+			}
+			if err := fn(v.Change); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.spill.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	for _, change := range tx.changes {
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Changes returns all changes of the transaction, loading the spilled
+// ones back into memory.
+func (tx *Transaction) Changes() ([]LogicalMessage, error) {
+	var changes = make([]LogicalMessage, 0, tx.count)
+	err := tx.Range(func(change LogicalMessage) error {
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (tx *Transaction) HasResponded() bool {
+	return atomic.LoadInt32(&tx.responded) == 1
+}
+
+func (tx *Transaction) canAck() bool {
+	return atomic.CompareAndSwapInt32(&tx.responded, 0, 1)
+}
+
+func (tx *Transaction) append(change LogicalMessage) error {
+	if tx.spill != nil {
+		if err := tx.spillEncoder.Encode(&spilledChange{Change: change}); err != nil {
+			return err
+		}
+		tx.spilled++
+		tx.count++
+		return nil
+	}
+	tx.changes = append(tx.changes, change)
+	tx.count++
+	return nil
+}
+
+func (tx *Transaction) spillTo(dir string) error {
+	if tx.spill != nil {
+		return nil
+	}
+
+	f, err := os.CreateTemp(dir, fmt.Sprintf("pgstream-%s-%d-*.tx", tx.Slot, tx.Xid))
+	if err != nil {
+		return err
+	}
+	tx.spill = f
+	tx.spillWriter = bufio.NewWriter(f)
+	tx.spillEncoder = gob.NewEncoder(tx.spillWriter)
+
+	for len(tx.changes) > 0 {
+		if err := tx.spillEncoder.Encode(&spilledChange{Change: tx.changes[0]}); err != nil {
+			return err
+		}
+		tx.changes = tx.changes[1:]
+		tx.spilled++
+	}
+	tx.changes = nil
+	return nil
+}
+
+func (tx *Transaction) release() {
+	if tx.spill != nil {
+		name := tx.spill.Name()
+		tx.spill.Close()
+		os.Remove(name)
+		tx.spill = nil
+	}
+}
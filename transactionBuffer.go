@@ -0,0 +1,48 @@
+package postgres
+
+// transactionBuffer collects the decoded changes of the transaction
+// currently streamed on a slot.
+type transactionBuffer struct {
+	maxMemory int
+	spillDir  string
+
+	tx   *Transaction
+	size int
+}
+
+func (b *transactionBuffer) active() bool {
+	return b.tx != nil
+}
+
+func (b *transactionBuffer) begin(tx *Transaction) {
+	b.discard()
+	b.tx = tx
+	b.size = 0
+}
+
+func (b *transactionBuffer) append(change LogicalMessage, size int) error {
+	if err := b.tx.append(change); err != nil {
+		return err
+	}
+
+	b.size += size
+	if b.maxMemory >= 0 && b.size > b.maxMemory {
+		return b.tx.spillTo(b.spillDir)
+	}
+	return nil
+}
+
+func (b *transactionBuffer) commit() *Transaction {
+	tx := b.tx
+	b.tx = nil
+	b.size = 0
+	return tx
+}
+
+func (b *transactionBuffer) discard() {
+	if b.tx != nil {
+		b.tx.release()
+		b.tx = nil
+	}
+	b.size = 0
+}
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransaction_Spill(t *testing.T) {
+	var (
+		buffer = &transactionBuffer{
+			maxMemory: 10,
+			spillDir:  t.TempDir(),
+		}
+		relation = &RelationMessage{Namespace: "public", RelationName: "foo"}
+	)
+
+	buffer.begin(&Transaction{Slot: "foo", Xid: 42})
+	for _, v := range []string{"1", "2", "3"} {
+		err := buffer.append(&InsertMessage{
+			Relation: relation,
+			New:      Tuple{{Name: "id", Kind: TupleDataTypeText, Data: []byte(v)}},
+		}, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx := buffer.commit()
+	if !tx.Spilled() {
+		t.Fatal("expected the transaction to be spilled")
+	}
+	if tx.Len() != 3 {
+		t.Fatalf("expected 3 changes, got %d", tx.Len())
+	}
+
+	changes, err := tx.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []string{"1", "2", "3"} {
+		insert := changes[i].(*InsertMessage)
+		if col, _ := insert.New.Get("id"); col.String() != expected {
+			t.Errorf("expected id '%s' at %d, got '%s'", expected, i, col.String())
+		}
+		if insert.Relation.QualifiedName() != "public.foo" {
+			t.Errorf("unexpected relation '%s'", insert.Relation.QualifiedName())
+		}
+	}
+
+	name := tx.spill.Name()
+	tx.release()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected spill file to be removed, got %v", err)
+	}
+	if _, err := tx.Changes(); err == nil {
+		t.Error("expected error reading released spilled changes")
+	}
+}
+
+func TestConsumer_TransactionHandler(t *testing.T) {
+	replication := newStandInReplication(ReplicationSlotSource{
+		SlotName:          "orders",
+		Plugin:            "test_decoding",
+		SlotType:          LogicalReplication,
+		Database:          "postgres",
+		ConfirmedFlushLSN: LSN(0x1000),
+	})
+	server := newStandInReplicationServer(t, replication)
+
+	var received = make(chan []LogicalMessage, 1)
+	consumer := &Consumer{
+		TransactionHandler: func(tx *Transaction) {
+			changes, err := tx.Changes()
+			if err != nil {
+				t.Error(err)
+			}
+			received <- changes
+		},
+		Decoder: new(TestDecodingDecoder),
+		Logger:  log.New(io.Discard, "", 0),
+		Config:  newStandInConfig(server),
+	}
+	if err := consumer.Subscribe(SlotOffset{Slot: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	stream := replication.Stream(t)
+	err := stream.Send(
+		newXLogDataTestMessage(LSN(0x2000), "BEGIN 42"),
+		newXLogDataTestMessage(LSN(0x2100), "table public.orders: INSERT: id[integer]:1"),
+		newXLogDataTestMessage(LSN(0x2200), "table public.orders: INSERT: id[integer]:2"),
+		newXLogDataTestMessage(LSN(0x2300), "COMMIT 42"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case changes := <-received:
+		if len(changes) != 2 {
+			t.Fatalf("expected 2 changes, got %d", len(changes))
+		}
+		for i, id := range []string{"1", "2"} {
+			insert, ok := changes[i].(*InsertMessage)
+			if !ok {
+				t.Fatalf("expected an InsertMessage, got %T", changes[i])
+			}
+			if col, _ := insert.New.Get("id"); col.String() != id {
+				t.Errorf("expected id %s, got %s", id, col.String())
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the transaction")
+	}
+	stream.WaitFlushed(t, LSN(0x2300))
+}
+
+func TestConsumerPollingWorker_TransactionBufferError(t *testing.T) {
+	var (
+		failures  []*ConsumerError
+		delivered int
+		consumer  = newTestConsumer(&Config{
+			TransactionMaxMemory: 1,
+			TransactionSpillDir:  filepath.Join(t.TempDir(), "missing"),
+		})
+	)
+	consumer.TransactionHandler = func(tx *Transaction) { delivered++ }
+	consumer.ErrorHandler = func(err *ConsumerError) ErrorDecision {
+		failures = append(failures, err)
+		return ErrorContinue
+	}
+	consumer.Decoder = new(TestDecodingDecoder)
+	worker := newConsumerPollingWorker(consumer, "orders", nil, LSN(0x1000))
+
+	worker.processData(newXLogDataTestMessage(LSN(0x2000), "BEGIN 42"))
+	worker.processData(newXLogDataTestMessage(LSN(0x2100), "table public.orders: INSERT: id[integer]:1"))
+
+	if len(failures) != 1 || failures[0].Phase != ErrorPhaseHandle {
+		t.Fatalf("unexpected errors %+v", failures)
+	}
+	if p := worker.progress.Progress(); p.Flushed != LSN(0x1000) {
+		t.Errorf("expected flushed %s, got %s", LSN(0x1000), p.Flushed)
+	}
+	if worker.resolveFailure(context.Background()) {
+		t.Fatal("expected the slot to stop")
+	}
+
+	worker.processData(newXLogDataTestMessage(LSN(0x2200), "COMMIT 42"))
+	if delivered != 0 {
+		t.Errorf("expected the broken transaction not to be delivered")
+	}
+}
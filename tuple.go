@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"github.com/jackc/pglogrepl"
+)
+
+const (
+	TupleDataTypeNull   = pglogrepl.TupleDataTypeNull
+	TupleDataTypeToast  = pglogrepl.TupleDataTypeToast
+	TupleDataTypeText   = pglogrepl.TupleDataTypeText
+	TupleDataTypeBinary = pglogrepl.TupleDataTypeBinary
+)
+
+type TupleColumn struct {
+	Name     string
+	DataType uint32
+	TypeName string
+	Kind     uint8
+	Data     []byte
+}
+
+func (c TupleColumn) IsNull() bool {
+	return c.Kind == TupleDataTypeNull
+}
+
+func (c TupleColumn) IsUnchangedToast() bool {
+	return c.Kind == TupleDataTypeToast
+}
+
+func (c TupleColumn) String() string {
+	return string(c.Data)
+}
+
+type Tuple []TupleColumn
+
+func (t Tuple) Get(name string) (TupleColumn, bool) {
+	for _, c := range t {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return TupleColumn{}, false
+}
+
+func (t Tuple) Names() []string {
+	var names = make([]string, len(t))
+	for i, c := range t {
+		names[i] = c.Name
+	}
+	return names
+}
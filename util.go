@@ -3,11 +3,14 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgconn"
+	"gopkg.in/yaml.v3"
 )
 
 func ParseReplicationMode(s string) (ReplicationMode, error) {
@@ -20,6 +23,18 @@ func ParseReplicationMode(s string) (ReplicationMode, error) {
 	return 0, fmt.Errorf("unsupported slot type '%s'", s)
 }
 
+func parseTimestamptz(s string) (time.Time, error) {
+	var err error
+	for _, layout := range timestamptzLayouts {
+		var ts time.Time
+		ts, err = time.Parse(layout, s)
+		if err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp '%s': %w", s, err)
+}
+
 func SelectReplicationSlot(ctx context.Context, conn *pgconn.PgConn, slots []string) (records []ReplicationSlotSource, err error) {
 	if len(slots) == 0 {
 		return
@@ -34,7 +49,20 @@ func SelectReplicationSlot(ctx context.Context, conn *pgconn.PgConn, slots []str
 		slotParam[i] = "'" + param + "'"
 	}
 
-	sql := fmt.Sprintf(__SQL_SELECT_REPLICATION_SLOT, strings.Join(slotParam, ","))
+	sql := fmt.Sprintf(__SQL_SELECT_REPLICATION_SLOT, replicationSlotWALStatusColumn(conn), strings.Join(slotParam, ","))
+	return queryReplicationSlots(ctx, conn, sql)
+}
+
+// replicationSlotWALStatusColumn returns the wal_status column of
+// pg_replication_slots when the server has it.
+func replicationSlotWALStatusColumn(conn *pgconn.PgConn) string {
+	if v := serverMajorVersion(conn); v > 0 && v < 13 {
+		return ""
+	}
+	return __SQL_REPLICATION_SLOT_WAL_STATUS
+}
+
+func queryReplicationSlots(ctx context.Context, conn *pgconn.PgConn, sql string) (records []ReplicationSlotSource, err error) {
 	reader := conn.Exec(ctx, sql)
 	result, err := reader.ReadAll()
 	if err != nil {
@@ -72,6 +100,9 @@ func SelectReplicationSlot(ctx context.Context, conn *pgconn.PgConn, slots []str
 				}
 				r.RestartLSN.Scan(string(v[6]))
 				r.ConfirmedFlushLSN.Scan(string(v[7]))
+				if len(v) > 8 {
+					r.WALStatus = string(v[8])
+				}
 
 				records[i] = r
 			}
@@ -88,34 +119,181 @@ func IsDuplicateObjectError(err error) bool {
 	return false
 }
 
+// CreateReplicationSlot creates every slot of the provider and stops at
+// the first failure. See CreateReplicationSlotWithResults for the
+// snapshot names and consistent points of the slots.
 func CreateReplicationSlot(ctx context.Context, conn *pgconn.PgConn, provider CreateReplicationSlotSourceProvider) error {
+	_, err := CreateReplicationSlotWithResults(ctx, conn, provider)
+	return err
+}
+
+// CreateReplicationSlotWithResults creates every slot of the provider and
+// returns the results in the same order. It stops at the first failure
+// and returns the results of the slots created so far.
+//
+// An exported snapshot is only valid until conn runs its next command,
+// so only the last result keeps its SnapshotName; create a slot whose
+// snapshot is needed on a connection of its own.
+func CreateReplicationSlotWithResults(ctx context.Context, conn *pgconn.PgConn, provider CreateReplicationSlotSourceProvider) ([]CreateReplicationSlotResult, error) {
+	var results = make([]CreateReplicationSlotResult, 0, len(provider.sources))
 	for _, source := range provider.sources {
-		_, err := pglogrepl.CreateReplicationSlot(ctx, conn,
-			source.SlotName,
-			source.Plugin,
-			pglogrepl.CreateReplicationSlotOptions{
-				Temporary: source.Temporary,
-				Mode:      source.SlotType,
-			})
+		result, err := createReplicationSlot(ctx, conn, source)
+		if err != nil {
+			return results, err
+		}
+		// the next command releases the snapshot of the previous slot
+		if n := len(results); n > 0 {
+			results[n-1].SnapshotName = ""
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func createReplicationSlot(ctx context.Context, conn *pgconn.PgConn, source CreateReplicationSlotSource) (CreateReplicationSlotResult, error) {
+	snapshotAction, err := parseSnapshotAction(source.SnapshotAction)
+	if err != nil {
+		return CreateReplicationSlotResult{}, err
+	}
+	if source.SlotType == PhysicalReplication && len(snapshotAction) > 0 {
+		return CreateReplicationSlotResult{}, fmt.Errorf("snapshot action '%s' is not supported by physical slot '%s'",
+			snapshotAction, source.SlotName)
+	}
+
+	r, err := pglogrepl.CreateReplicationSlot(ctx, conn,
+		source.SlotName,
+		source.Plugin,
+		pglogrepl.CreateReplicationSlotOptions{
+			Temporary:      source.Temporary,
+			SnapshotAction: snapshotAction,
+			Mode:           source.SlotType,
+		})
+	if err != nil {
+		return CreateReplicationSlotResult{}, err
+	}
+
+	result := CreateReplicationSlotResult{
+		SlotName:     r.SlotName,
+		SnapshotName: r.SnapshotName,
+		OutputPlugin: r.OutputPlugin,
+	}
+	if len(r.ConsistentPoint) > 0 {
+		result.ConsistentPoint, err = pglogrepl.ParseLSN(r.ConsistentPoint)
 		if err != nil {
-			return err
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// scanIdentifier reads an SQL identifier that is either quoted
+// or terminated by one of the runes in stop.
+func scanIdentifier(text, stop string) (ident, rest string, err error) {
+	if strings.HasPrefix(text, `"`) {
+		var sb strings.Builder
+		for i := 1; i < len(text); i++ {
+			if text[i] == '"' {
+				if i+1 < len(text) && text[i+1] == '"' {
+					sb.WriteByte('"')
+					i++
+					continue
+				}
+				return sb.String(), text[i+1:], nil
+			}
+			sb.WriteByte(text[i])
+		}
+		return "", "", fmt.Errorf("unterminated quoted identifier '%s'", text)
+	}
+
+	i := strings.IndexAny(text, stop)
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid identifier '%s'", text)
+	}
+	return text[:i], text[i:], nil
+}
+
+// expandYAMLEnv replaces $NAME, ${NAME} and ${NAME:-default} in the
+// scalar node with the environment variables; "$$" is a literal "$". A
+// variable that is not set and has no default is an error.
+func expandYAMLEnv(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode || !strings.Contains(node.Value, "$") {
+		return nil
+	}
+
+	var err error
+	value := os.Expand(node.Value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		if i := strings.Index(name, ":-"); i >= 0 {
+			if v, ok := os.LookupEnv(name[:i]); ok && len(v) > 0 {
+				return v
+			}
+			return name[i+2:]
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable '%s' is not set", name)
+		}
+		return v
+	})
+	if err != nil {
+		return err
+	}
+
+	if value != node.Value {
+		node.Value = value
+		// resolve the expanded plain scalar again, e.g. as a bool
+		if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 {
+			node.Tag = ""
 		}
 	}
 	return nil
 }
 
+func parseSnapshotAction(s string) (string, error) {
+	switch action := strings.ToUpper(s); action {
+	case "", ExportSnapshot, NoExportSnapshot, UseSnapshot:
+		return action, nil
+	}
+	return "", fmt.Errorf("unsupported snapshot action '%s'", s)
+}
+
 func NewConn(config *Config) (*pgconn.PgConn, error) {
+	return NewConnContext(context.Background(), config)
+}
+
+func NewConnContext(ctx context.Context, config *Config) (*pgconn.PgConn, error) {
+	return connect(ctx, config, true)
+}
+
+// newQueryConnContext opens a regular, non-replication connection with
+// the same settings as NewConnContext.
+func newQueryConnContext(ctx context.Context, config *Config) (*pgconn.PgConn, error) {
+	return connect(ctx, config, false)
+}
+
+func connect(ctx context.Context, config *Config, replication bool) (*pgconn.PgConn, error) {
 	config.init()
 
-	c, err := pgconn.ParseConfig(fmt.Sprintf("postgres://%s?replication=database", config.Host))
+	c, attrs, err := config.pgconnConfig()
 	if err != nil {
 		return nil, err
 	}
-	c.Port = config.Port
-	c.User = config.User
-	c.Password = config.Password
-	c.Database = config.Database
-	c.ConnectTimeout = config.ConnectTimeout
+	if !replication {
+		delete(c.RuntimeParams, "replication")
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, c)
+	if err != nil && attrs == TargetSessionAttrsPreferStandby && ctx.Err() == nil {
+		// no standby is available; take any server that accepts the
+		// connection, primary or not
+		c.ValidateConnect = nil
+		return pgconn.ConnectConfig(ctx, c)
+	}
+	return conn, err
+}
 
-	return pgconn.ConnectConfig(context.Background(), c)
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 }
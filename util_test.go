@@ -2,7 +2,12 @@ package postgres
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/jackc/pgx/v5/pgconn"
@@ -37,3 +42,319 @@ func TestSelectReplicationSlot(t *testing.T) {
 
 	t.Logf("%+v\n", records)
 }
+
+func TestNewConn_TLS(t *testing.T) {
+	cert, caFile := newStandInCertificate(t)
+
+	server := &standInServer{
+		TLSConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+		RequireTLS: true,
+	}
+	server.start(t)
+
+	conn, err := NewConn(&Config{
+		Host:        server.Host,
+		Port:        server.Port,
+		User:        "postgres",
+		Database:    "postgres",
+		SSLMode:     "verify-full",
+		SSLRootCert: caFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close(context.Background())
+
+	startups := server.Startups()
+	if len(startups) != 1 {
+		t.Fatalf("expected 1 startup, got %d", len(startups))
+	}
+	if !startups[0].TLS {
+		t.Error("expected the connection to use TLS")
+	}
+	if v := startups[0].Parameters["replication"]; v != "database" {
+		t.Errorf("expected replication=database, got '%s'", v)
+	}
+}
+
+func TestNewConn_TLSUnknownAuthority(t *testing.T) {
+	cert, _ := newStandInCertificate(t)
+	_, otherCAFile := newStandInCertificate(t)
+
+	server := &standInServer{
+		TLSConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+		RequireTLS: true,
+	}
+	server.start(t)
+
+	_, err := NewConn(&Config{
+		Host:        server.Host,
+		Port:        server.Port,
+		User:        "postgres",
+		SSLMode:     "verify-full",
+		SSLRootCert: otherCAFile,
+	})
+	if err == nil {
+		t.Fatal("expected certificate verification to fail")
+	}
+}
+
+func TestNewConn_TLSConfig(t *testing.T) {
+	cert, caFile := newStandInCertificate(t)
+
+	server := &standInServer{
+		TLSConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+		RequireTLS: true,
+	}
+	server.start(t)
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+
+	_, err = NewConn(&Config{
+		Host:      server.Host,
+		Port:      server.Port,
+		User:      "postgres",
+		SSLMode:   "disable",
+		TLSConfig: &tls.Config{RootCAs: roots},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if startups := server.Startups(); len(startups) != 1 || !startups[0].TLS {
+		t.Errorf("expected a single TLS startup, got %+v", startups)
+	}
+}
+
+func TestNewConn_TLSRequired(t *testing.T) {
+	cert, _ := newStandInCertificate(t)
+
+	server := &standInServer{
+		TLSConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+		RequireTLS: true,
+	}
+	server.start(t)
+
+	_, err := NewConn(&Config{
+		Host:    server.Host,
+		Port:    server.Port,
+		User:    "postgres",
+		SSLMode: "disable",
+	})
+	if err == nil {
+		t.Fatal("expected the server to reject a plain connection")
+	}
+}
+
+func TestNewConn_TargetSessionAttrs(t *testing.T) {
+	var (
+		standby = newStandInNode(t, "standby", true)
+		primary = newStandInNode(t, "primary", false)
+		hosts   = []string{
+			fmt.Sprintf("%s:%d", standby.Host, standby.Port),
+			fmt.Sprintf("%s:%d", primary.Host, primary.Port),
+		}
+	)
+
+	cases := []struct {
+		attrs    TargetSessionAttrs
+		hosts    []string
+		expected string
+	}{
+		{TargetSessionAttrsAny, hosts, "standby"},
+		{TargetSessionAttrsPrimary, hosts, "primary"},
+		{TargetSessionAttrsReadWrite, hosts, "primary"},
+		{TargetSessionAttrsStandby, hosts, "standby"},
+		{TargetSessionAttrsReadOnly, hosts, "standby"},
+		{TargetSessionAttrsPreferStandby, []string{hosts[1], hosts[0]}, "standby"},
+		{TargetSessionAttrsPreferStandby, hosts[1:], "primary"},
+	}
+	for _, c := range cases {
+		conn, err := NewConn(&Config{
+			Hosts:              c.hosts,
+			User:               "postgres",
+			SSLMode:            "disable",
+			TargetSessionAttrs: c.attrs,
+		})
+		if err != nil {
+			t.Errorf("%s: %v", c.attrs, err)
+			continue
+		}
+		if name := conn.ParameterStatus("stand_in_name"); name != c.expected {
+			t.Errorf("%s: expected '%s', got '%s'", c.attrs, c.expected, name)
+		}
+		conn.Close(context.Background())
+	}
+
+	_, err := NewConn(&Config{
+		Hosts:              hosts[:1],
+		User:               "postgres",
+		SSLMode:            "disable",
+		TargetSessionAttrs: TargetSessionAttrsPrimary,
+	})
+	if err == nil {
+		t.Error("expected no primary to be found")
+	}
+}
+
+func TestNewConn_ConnStringTargetSessionAttrs(t *testing.T) {
+	var (
+		standby = newStandInNode(t, "standby", true)
+		primary = newStandInNode(t, "primary", false)
+	)
+
+	conn, err := NewConn(&Config{
+		ConnString: fmt.Sprintf("host=%s,%s port=%d,%d user=postgres sslmode=disable target_session_attrs=primary",
+			standby.Host, primary.Host, standby.Port, primary.Port),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if name := conn.ParameterStatus("stand_in_name"); name != "primary" {
+		t.Errorf("expected 'primary', got '%s'", name)
+	}
+}
+
+func TestNewConn_EnvironmentTargetSessionAttrs(t *testing.T) {
+	var (
+		standby = newStandInNode(t, "standby", true)
+		primary = newStandInNode(t, "primary", false)
+	)
+	t.Setenv("PGTARGETSESSIONATTRS", "primary")
+
+	conn, err := NewConn(&Config{
+		ConnString: fmt.Sprintf("postgres://postgres@%s:%d,%s:%d/?sslmode=disable",
+			standby.Host, standby.Port, primary.Host, primary.Port),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(context.Background())
+
+	if name := conn.ParameterStatus("stand_in_name"); name != "primary" {
+		t.Errorf("expected 'primary', got '%s'", name)
+	}
+}
+
+func TestLookupTargetSessionAttrs(t *testing.T) {
+	servicefile := filepath.Join(t.TempDir(), "pg_service.conf")
+	err := os.WriteFile(servicefile, []byte("[orders]\nhost=svc.example.com\ntarget_session_attrs=standby\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PGSERVICEFILE", servicefile)
+	t.Setenv("PGTARGETSESSIONATTRS", "read-only")
+
+	cases := []struct {
+		connString string
+		expected   TargetSessionAttrs
+	}{
+		{"host=localhost target_session_attrs=primary", TargetSessionAttrsPrimary},
+		{"host=localhost application_name='a b\\' c' target_session_attrs = 'read-write'", TargetSessionAttrsReadWrite},
+		{"postgres://localhost/orders?target_session_attrs=prefer-standby", TargetSessionAttrsPreferStandby},
+		{"service=orders user=alice", TargetSessionAttrsStandby},
+		{"service=orders target_session_attrs=primary", TargetSessionAttrsPrimary},
+		{"postgres://localhost/orders", TargetSessionAttrsReadOnly},
+	}
+	for _, c := range cases {
+		attrs, err := lookupTargetSessionAttrs(c.connString)
+		if err != nil {
+			t.Errorf("%s: %v", c.connString, err)
+			continue
+		}
+		if attrs != c.expected {
+			t.Errorf("%s: expected '%s', got '%s'", c.connString, c.expected, attrs)
+		}
+	}
+
+	if _, err := lookupTargetSessionAttrs("service=missing"); err == nil {
+		t.Error("expected error for an unknown service")
+	}
+}
+
+func TestCreateReplicationSlot(t *testing.T) {
+	var (
+		slots = newStandInSlots()
+		conn  = connectStandIn(t, newStandInSlotServer(t, slots))
+		p     CreateReplicationSlotSourceProvider
+	)
+	p.AppendSource(CreateReplicationSlotSource{
+		SlotName: "standby",
+		SlotType: PhysicalReplication,
+	})
+	p.AppendSource(CreateReplicationSlotSource{
+		SlotName:       "orders",
+		Plugin:         PgOutputPlugin,
+		SlotType:       LogicalReplication,
+		SnapshotAction: "export_snapshot",
+	})
+
+	results, err := CreateReplicationSlotWithResults(context.Background(), conn, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	if r := results[1]; r.SlotName != "orders" || r.SnapshotName == "" || r.OutputPlugin != PgOutputPlugin || r.ConsistentPoint == 0 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if q := slots.Queries()[1]; !strings.HasSuffix(q, " "+ExportSnapshot) {
+		t.Errorf("expected snapshot action in '%s'", q)
+	}
+}
+
+func TestCreateReplicationSlotWithResults_ExportedSnapshots(t *testing.T) {
+	var (
+		slots = newStandInSlots()
+		conn  = connectStandIn(t, newStandInSlotServer(t, slots))
+		p     CreateReplicationSlotSourceProvider
+	)
+	for _, name := range []string{"orders", "audit"} {
+		p.AppendSource(CreateReplicationSlotSource{
+			SlotName:       name,
+			Plugin:         PgOutputPlugin,
+			SlotType:       LogicalReplication,
+			SnapshotAction: ExportSnapshot,
+		})
+	}
+
+	results, err := CreateReplicationSlotWithResults(context.Background(), conn, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	if results[0].SnapshotName != "" {
+		t.Errorf("expected the released snapshot to be cleared, got %+v", results[0])
+	}
+	if results[1].SnapshotName == "" {
+		t.Errorf("expected the snapshot of the last slot, got %+v", results[1])
+	}
+}
+
+func TestCreateReplicationSlot_InvalidSnapshotAction(t *testing.T) {
+	var (
+		slots = newStandInSlots()
+		conn  = connectStandIn(t, newStandInSlotServer(t, slots))
+	)
+
+	for _, source := range []CreateReplicationSlotSource{
+		{SlotName: "orders", Plugin: PgOutputPlugin, SlotType: LogicalReplication, SnapshotAction: "KEEP_SNAPSHOT"},
+		{SlotName: "standby", SlotType: PhysicalReplication, SnapshotAction: ExportSnapshot},
+	} {
+		if err := CreateReplicationSlot(context.Background(), conn, source.AsProvider()); err == nil {
+			t.Errorf("expected error for %+v", source)
+		}
+	}
+	if n := len(slots.Queries()); n != 0 {
+		t.Errorf("expected no command to be sent, got %d", n)
+	}
+}
@@ -0,0 +1,357 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+)
+
+var _ MessageDecoder = new(Wal2JsonDecoder)
+
+// Wal2JsonDecoder decodes wal2json output. FormatVersion selects the
+// format-version the slot was started with; when it is zero the format
+// is detected from each payload.
+type Wal2JsonDecoder struct {
+	FormatVersion int
+}
+
+// Decode implements MessageDecoder.
+func (d *Wal2JsonDecoder) Decode(relations *RelationCache, data []byte) ([]LogicalMessage, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty wal2json message")
+	}
+
+	switch d.FormatVersion {
+	case 1:
+		return d.decodeV1(data)
+	case 2:
+		return d.decodeV2(data)
+	case 0:
+		var probe struct {
+			Action *string          `json:"action"`
+			Change *json.RawMessage `json:"change"`
+		}
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return nil, err
+		}
+		if probe.Action != nil {
+			return d.decodeV2(data)
+		}
+		return d.decodeV1(data)
+	}
+	return nil, fmt.Errorf("unsupported wal2json format-version %d", d.FormatVersion)
+}
+
+type wal2JsonV1Transaction struct {
+	Xid       uint32             `json:"xid"`
+	NextLSN   string             `json:"nextlsn"`
+	Timestamp string             `json:"timestamp"`
+	Change    []wal2JsonV1Change `json:"change"`
+}
+
+type wal2JsonV1Change struct {
+	Kind         string            `json:"kind"`
+	Schema       string            `json:"schema"`
+	Table        string            `json:"table"`
+	ColumnNames  []string          `json:"columnnames"`
+	ColumnTypes  []string          `json:"columntypes"`
+	ColumnValues []json.RawMessage `json:"columnvalues"`
+	OldKeys      *struct {
+		KeyNames  []string          `json:"keynames"`
+		KeyTypes  []string          `json:"keytypes"`
+		KeyValues []json.RawMessage `json:"keyvalues"`
+	} `json:"oldkeys"`
+	PK *struct {
+		PKNames []string `json:"pknames"`
+		PKTypes []string `json:"pktypes"`
+	} `json:"pk"`
+	Transactional bool   `json:"transactional"`
+	Prefix        string `json:"prefix"`
+	Content       string `json:"content"`
+}
+
+func (d *Wal2JsonDecoder) decodeV1(data []byte) ([]LogicalMessage, error) {
+	var tx wal2JsonV1Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return nil, err
+	}
+
+	var (
+		begin  = &BeginMessage{Xid: tx.Xid}
+		commit = &CommitMessage{}
+	)
+	if len(tx.Timestamp) > 0 {
+		ts, err := parseTimestamptz(tx.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		begin.CommitTime = ts
+		commit.CommitTime = ts
+	}
+	if len(tx.NextLSN) > 0 {
+		lsn, err := pglogrepl.ParseLSN(tx.NextLSN)
+		if err != nil {
+			return nil, err
+		}
+		// the end of the transaction, not its commit LSN
+		commit.TransactionEndLSN = lsn
+	}
+
+	var msgs = make([]LogicalMessage, 0, len(tx.Change)+2)
+	msgs = append(msgs, begin)
+	for i, c := range tx.Change {
+		var msg LogicalMessage
+		switch c.Kind {
+		case "insert", "update", "delete", "truncate":
+			relation := newWal2JsonRelation(c.Schema, c.Table, c.ColumnNames, c.ColumnTypes)
+			if c.PK != nil {
+				markWal2JsonKeys(relation, c.PK.PKNames, c.PK.PKTypes)
+			}
+
+			newTuple, err := newWal2JsonTuple(c.ColumnNames, c.ColumnTypes, c.ColumnValues)
+			if err != nil {
+				return nil, fmt.Errorf("change[%d]: %w", i, err)
+			}
+			var oldTuple Tuple
+			if c.OldKeys != nil {
+				oldTuple, err = newWal2JsonTuple(c.OldKeys.KeyNames, c.OldKeys.KeyTypes, c.OldKeys.KeyValues)
+				if err != nil {
+					return nil, fmt.Errorf("change[%d]: %w", i, err)
+				}
+				if c.PK == nil {
+					markWal2JsonKeys(relation, c.OldKeys.KeyNames, c.OldKeys.KeyTypes)
+				}
+			}
+
+			switch c.Kind {
+			case "insert":
+				msg = &InsertMessage{Relation: relation, New: newTuple}
+			case "update":
+				msg = &UpdateMessage{Relation: relation, Old: oldTuple, New: newTuple}
+			case "delete":
+				msg = &DeleteMessage{Relation: relation, Old: oldTuple}
+			case "truncate":
+				msg = &TruncateMessage{Relations: []*RelationMessage{relation}}
+			}
+		case "message":
+			msg = &LogicalDecodingMessage{
+				Transactional: c.Transactional,
+				Prefix:        c.Prefix,
+				Content:       []byte(c.Content),
+			}
+		default:
+			return nil, fmt.Errorf("change[%d]: unsupported wal2json kind '%s'", i, c.Kind)
+		}
+		msgs = append(msgs, msg)
+	}
+	msgs = append(msgs, commit)
+	return msgs, nil
+}
+
+type wal2JsonV2Column struct {
+	Name  string          `json:"name"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type wal2JsonV2Record struct {
+	Action        string             `json:"action"`
+	Xid           uint32             `json:"xid"`
+	Timestamp     string             `json:"timestamp"`
+	LSN           string             `json:"lsn"`
+	NextLSN       string             `json:"nextlsn"`
+	Schema        string             `json:"schema"`
+	Table         string             `json:"table"`
+	Columns       []wal2JsonV2Column `json:"columns"`
+	Identity      []wal2JsonV2Column `json:"identity"`
+	PK            []wal2JsonV2Column `json:"pk"`
+	Transactional bool               `json:"transactional"`
+	Prefix        string             `json:"prefix"`
+	Content       string             `json:"content"`
+}
+
+func (d *Wal2JsonDecoder) decodeV2(data []byte) ([]LogicalMessage, error) {
+	var r wal2JsonV2Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+
+	var (
+		ts  time.Time
+		lsn LSN
+		err error
+	)
+	if len(r.Timestamp) > 0 {
+		ts, err = parseTimestamptz(r.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(r.LSN) > 0 {
+		lsn, err = pglogrepl.ParseLSN(r.LSN)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var msg LogicalMessage
+	switch r.Action {
+	case "B":
+		// the lsn of the B record is not the commit LSN
+		msg = &BeginMessage{Xid: r.Xid, CommitTime: ts}
+	case "C":
+		commit := &CommitMessage{CommitLSN: lsn, CommitTime: ts}
+		if len(r.NextLSN) > 0 {
+			commit.TransactionEndLSN, err = pglogrepl.ParseLSN(r.NextLSN)
+			if err != nil {
+				return nil, err
+			}
+		}
+		msg = commit
+	case "I", "U", "D", "T":
+		var names, types []string
+		for _, c := range r.Columns {
+			names = append(names, c.Name)
+			types = append(types, c.Type)
+		}
+		relation := newWal2JsonRelation(r.Schema, r.Table, names, types)
+		for _, c := range r.PK {
+			markWal2JsonKeys(relation, []string{c.Name}, []string{c.Type})
+		}
+		if len(r.PK) == 0 {
+			for _, c := range r.Identity {
+				markWal2JsonKeys(relation, []string{c.Name}, []string{c.Type})
+			}
+		}
+
+		newTuple, err := newWal2JsonV2Tuple(r.Columns)
+		if err != nil {
+			return nil, err
+		}
+		oldTuple, err := newWal2JsonV2Tuple(r.Identity)
+		if err != nil {
+			return nil, err
+		}
+
+		switch r.Action {
+		case "I":
+			msg = &InsertMessage{Relation: relation, New: newTuple}
+		case "U":
+			msg = &UpdateMessage{Relation: relation, Old: oldTuple, New: newTuple}
+		case "D":
+			msg = &DeleteMessage{Relation: relation, Old: oldTuple}
+		case "T":
+			msg = &TruncateMessage{Relations: []*RelationMessage{relation}}
+		}
+	case "M":
+		msg = &LogicalDecodingMessage{
+			LSN:           lsn,
+			Transactional: r.Transactional,
+			Prefix:        r.Prefix,
+			Content:       []byte(r.Content),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported wal2json action '%s'", r.Action)
+	}
+	return []LogicalMessage{msg}, nil
+}
+
+func newWal2JsonRelation(schema, table string, names, types []string) *RelationMessage {
+	var r = &RelationMessage{
+		Namespace:    schema,
+		RelationName: table,
+		Columns:      make([]RelationColumn, len(names)),
+	}
+	for i, name := range names {
+		r.Columns[i].Name = name
+		if i < len(types) {
+			r.Columns[i].TypeName = types[i]
+		}
+	}
+	return r
+}
+
+func markWal2JsonKeys(relation *RelationMessage, names, types []string) {
+	for i, name := range names {
+		var found bool
+		for j := range relation.Columns {
+			if relation.Columns[j].Name == name {
+				relation.Columns[j].Key = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			col := RelationColumn{Name: name, Key: true}
+			if i < len(types) {
+				col.TypeName = types[i]
+			}
+			relation.Columns = append(relation.Columns, col)
+		}
+	}
+}
+
+func newWal2JsonTuple(names, types []string, values []json.RawMessage) (Tuple, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if len(values) != len(names) {
+		return nil, fmt.Errorf("expected %d wal2json values, got %d", len(names), len(values))
+	}
+
+	var tuple = make(Tuple, len(names))
+	for i, name := range names {
+		col, err := newWal2JsonColumn(name, values[i])
+		if err != nil {
+			return nil, err
+		}
+		if i < len(types) {
+			col.TypeName = types[i]
+		}
+		tuple[i] = col
+	}
+	return tuple, nil
+}
+
+func newWal2JsonV2Tuple(columns []wal2JsonV2Column) (Tuple, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+
+	var tuple = make(Tuple, len(columns))
+	for i, c := range columns {
+		col, err := newWal2JsonColumn(c.Name, c.Value)
+		if err != nil {
+			return nil, err
+		}
+		col.TypeName = c.Type
+		tuple[i] = col
+	}
+	return tuple, nil
+}
+
+func newWal2JsonColumn(name string, value json.RawMessage) (TupleColumn, error) {
+	var col = TupleColumn{
+		Name: name,
+		Kind: TupleDataTypeText,
+	}
+
+	value = bytes.TrimSpace(value)
+	switch {
+	case len(value) == 0 || bytes.Equal(value, []byte("null")):
+		col.Kind = TupleDataTypeNull
+	case value[0] == '"':
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return col, fmt.Errorf("column '%s': %w", name, err)
+		}
+		col.Data = []byte(s)
+	default:
+		col.Data = []byte(value)
+	}
+	return col, nil
+}
@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+)
+
+func TestWal2JsonDecoder_FormatVersion1(t *testing.T) {
+	var data = `{
+	"xid": 1234,
+	"nextlsn": "0/16B3748",
+	"timestamp": "2024-05-06 07:08:09.123456+00",
+	"change": [
+		{
+			"kind": "insert",
+			"schema": "public",
+			"table": "foo",
+			"columnnames": ["id", "name", "note"],
+			"columntypes": ["integer", "text", "text"],
+			"columnvalues": [1, "x", null],
+			"pk": {"pknames": ["id"], "pktypes": ["integer"]}
+		},
+		{
+			"kind": "delete",
+			"schema": "public",
+			"table": "foo",
+			"oldkeys": {"keynames": ["id"], "keytypes": ["integer"], "keyvalues": [2]}
+		}
+	]
+}`
+
+	msgs, err := new(Wal2JsonDecoder).Decode(nil, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(msgs))
+	}
+
+	begin, ok := msgs[0].(*BeginMessage)
+	if !ok || begin.Xid != 1234 || begin.CommitTime.IsZero() || begin.FinalLSN != 0 {
+		t.Errorf("unexpected begin: %+v", msgs[0])
+	}
+	insert, ok := msgs[1].(*InsertMessage)
+	if !ok {
+		t.Fatalf("expected *InsertMessage, got %T", msgs[1])
+	}
+	if keys := insert.Relation.KeyColumns(); len(keys) != 1 || keys[0] != "id" {
+		t.Errorf("expected key columns [id], got %v", keys)
+	}
+	if col, _ := insert.New.Get("name"); col.String() != "x" {
+		t.Errorf("expected name 'x', got '%s'", col.String())
+	}
+	if col, _ := insert.New.Get("note"); !col.IsNull() {
+		t.Errorf("expected note to be null, got %+v", col)
+	}
+	del, ok := msgs[2].(*DeleteMessage)
+	if !ok {
+		t.Fatalf("expected *DeleteMessage, got %T", msgs[2])
+	}
+	if col, _ := del.Old.Get("id"); col.String() != "2" {
+		t.Errorf("expected old id '2', got '%s'", col.String())
+	}
+	commit, ok := msgs[3].(*CommitMessage)
+	if !ok || commit.TransactionEndLSN != pglogrepl.LSN(0x16B3748) || commit.CommitLSN != 0 {
+		t.Errorf("unexpected commit: %+v", msgs[3])
+	}
+}
+
+func TestWal2JsonDecoder_FormatVersion2(t *testing.T) {
+	var records = []string{
+		`{"action":"B","xid":1234,"lsn":"0/16B3748"}`,
+		`{"action":"U","schema":"public","table":"foo","columns":[{"name":"id","type":"integer","value":1},{"name":"name","type":"text","value":"y"}],"identity":[{"name":"id","type":"integer","value":1}]}`,
+		`{"action":"C","xid":1234,"lsn":"0/16B3780","nextlsn":"0/16B37B0"}`,
+	}
+
+	var (
+		decoder = &Wal2JsonDecoder{FormatVersion: 2}
+		types   []MessageType
+	)
+	for _, r := range records {
+		msgs, err := decoder.Decode(nil, []byte(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range msgs {
+			types = append(types, m.Type())
+		}
+		if begin, ok := msgs[0].(*BeginMessage); ok && begin.FinalLSN != 0 {
+			t.Errorf("expected no final LSN, got %s", begin.FinalLSN)
+		}
+		if commit, ok := msgs[0].(*CommitMessage); ok &&
+			(commit.CommitLSN != pglogrepl.LSN(0x16B3780) || commit.TransactionEndLSN != pglogrepl.LSN(0x16B37B0)) {
+			t.Errorf("unexpected commit: %+v", commit)
+		}
+		if update, ok := msgs[0].(*UpdateMessage); ok {
+			if update.Relation.QualifiedName() != "public.foo" {
+				t.Errorf("expected relation 'public.foo', got '%s'", update.Relation.QualifiedName())
+			}
+			if col, _ := update.New.Get("name"); col.String() != "y" {
+				t.Errorf("expected name 'y', got '%s'", col.String())
+			}
+			if len(update.Old) != 1 {
+				t.Errorf("expected 1 identity column, got %d", len(update.Old))
+			}
+		}
+	}
+
+	var expected = []MessageType{MessageTypeBegin, MessageTypeUpdate, MessageTypeCommit}
+	if len(types) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, types)
+		}
+	}
+}
+
+func TestWithPluginArg(t *testing.T) {
+	var opt pglogrepl.StartReplicationOptions
+	for _, v := range ConfigureReplicationOptions().
+		WithPluginArgs(`"pretty-print" 'true'`).
+		WithWal2JsonIncludeXids(true).
+		WithWal2JsonAddTables("public.foo", "public.bar").
+		WithPluginArg("it's", "o'k") {
+		v.applyStartReplicationOptions(&opt)
+	}
+
+	var expected = []string{
+		`"pretty-print" 'true'`,
+		`"include-xids" 'true'`,
+		`"add-tables" 'public.foo,public.bar'`,
+		`"it's" 'o''k'`,
+	}
+	if len(opt.PluginArgs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, opt.PluginArgs)
+	}
+	for i := range expected {
+		if opt.PluginArgs[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], opt.PluginArgs[i])
+		}
+	}
+
+	// WithPluginArgs replaces the arguments set before
+	WithPluginArgs(`"include-lsn" 'true'`).applyStartReplicationOptions(&opt)
+	if len(opt.PluginArgs) != 1 || opt.PluginArgs[0] != `"include-lsn" 'true'` {
+		t.Errorf("expected the arguments to be replaced, got %v", opt.PluginArgs)
+	}
+}
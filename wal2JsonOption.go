@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+)
+
+// /////////////////////////////////
+func WithWal2JsonFormatVersion(version int) ReplicationOption {
+	return WithPluginArg("format-version", strconv.Itoa(version))
+}
+
+// /////////////////////////////////
+func WithWal2JsonIncludeXids(enabled bool) ReplicationOption {
+	return WithPluginArg("include-xids", strconv.FormatBool(enabled))
+}
+
+// /////////////////////////////////
+func WithWal2JsonIncludeTimestamp(enabled bool) ReplicationOption {
+	return WithPluginArg("include-timestamp", strconv.FormatBool(enabled))
+}
+
+// /////////////////////////////////
+func WithWal2JsonIncludeLSN(enabled bool) ReplicationOption {
+	return WithPluginArg("include-lsn", strconv.FormatBool(enabled))
+}
+
+// /////////////////////////////////
+func WithWal2JsonIncludePK(enabled bool) ReplicationOption {
+	return WithPluginArg("include-pk", strconv.FormatBool(enabled))
+}
+
+// /////////////////////////////////
+func WithWal2JsonIncludeTypes(enabled bool) ReplicationOption {
+	return WithPluginArg("include-types", strconv.FormatBool(enabled))
+}
+
+// /////////////////////////////////
+func WithWal2JsonIncludeTransaction(enabled bool) ReplicationOption {
+	return WithPluginArg("include-transaction", strconv.FormatBool(enabled))
+}
+
+// /////////////////////////////////
+func WithWal2JsonPrettyPrint(enabled bool) ReplicationOption {
+	return WithPluginArg("pretty-print", strconv.FormatBool(enabled))
+}
+
+// WithWal2JsonAddTables limits the output to the given schema-qualified
+// tables. Special characters in the names must already be escaped as
+// wal2json expects.
+func WithWal2JsonAddTables(tables ...string) ReplicationOption {
+	return WithPluginArg("add-tables", strings.Join(tables, ","))
+}
+
+// WithWal2JsonFilterTables excludes the given schema-qualified tables.
+// Special characters in the names must already be escaped as wal2json
+// expects.
+func WithWal2JsonFilterTables(tables ...string) ReplicationOption {
+	return WithPluginArg("filter-tables", strings.Join(tables, ","))
+}
+
+// /////////////////////////////////
+func WithWal2JsonActions(actions ...string) ReplicationOption {
+	return WithPluginArg("actions", strings.Join(actions, ","))
+}
+
+// /////////////////////////////////
+func WithWal2JsonAddMsgPrefixes(prefixes ...string) ReplicationOption {
+	return WithPluginArg("add-msg-prefixes", strings.Join(prefixes, ","))
+}
+
+// /////////////////////////////////
+func WithWal2JsonFilterMsgPrefixes(prefixes ...string) ReplicationOption {
+	return WithPluginArg("filter-msg-prefixes", strings.Join(prefixes, ","))
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// WALError is an ErrorResponse the server sent on the replication
+// stream of Slot. It unwraps to a *pgconn.PgError.
+type WALError struct {
+	Slot     string
+	LSN      LSN // the last position received before the error
+	Response *pgproto3.ErrorResponse
+}
+
+func (e *WALError) Error() string {
+	return fmt.Sprintf("received Postgres WAL error on (%s#%s): %s (SQLSTATE %s)",
+		e.Slot, e.LSN, e.Response.Message, e.Response.Code)
+}
+
+func (e *WALError) Unwrap() error {
+	return pgconn.ErrorResponseToPgError(e.Response)
+}
@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+func TestWALError(t *testing.T) {
+	var err error = &WALError{
+		Slot: "orders",
+		LSN:  LSN(0x2000),
+		Response: &pgproto3.ErrorResponse{
+			Severity: "ERROR",
+			Code:     "55000",
+			Message:  "requested WAL segment has already been removed",
+		},
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "55000" {
+		t.Fatalf("expected a PgError, got %v", err)
+	}
+	expected := "received Postgres WAL error on (orders#0/2000): requested WAL segment has already been removed (SQLSTATE 55000)"
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}